@@ -0,0 +1,160 @@
+package flexqueue
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time used by a queue for TTL expiration, lease
+// visibility timeouts and the background expiry janitor. The default clock
+// uses the system time. Tests can use FakeClock to control time explicitly.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single use timer created by a Clock
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+}
+
+// SystemClock is the Clock backed by the system time
+type SystemClock struct{}
+
+// Now returns the current system time
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer creates a timer which fires after the duration of system time
+func (SystemClock) NewTimer(d time.Duration) Timer {
+	return systemTimer{time.NewTimer(d)}
+}
+
+// systemTimer adapts time.Timer to the Timer interface
+type systemTimer struct {
+	timer *time.Timer
+}
+
+func (t systemTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+func (t systemTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// FakeClock is a manually advanced Clock for deterministic tests. Time only
+// moves when Advance or Set is called, at which point any timers that are due
+// fire. It is safe for concurrent use.
+type FakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers map[*fakeTimer]struct{}
+}
+
+// NewFakeClock creates a fake clock starting at the given time
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{
+		now:    now,
+		timers: make(map[*fakeTimer]struct{}),
+	}
+}
+
+// Now returns the current fake time
+func (c *FakeClock) Now() time.Time {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.now
+}
+
+// NewTimer creates a timer which fires once the fake time has advanced by
+// the duration
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{
+		clock:   c,
+		expires: c.now.Add(d),
+		c:       make(chan time.Time, 1),
+	}
+
+	if d <= 0 {
+		t.c <- c.now
+		return t
+	}
+
+	c.timers[t] = struct{}{}
+
+	return t
+}
+
+// Advance moves the fake time forward by the duration and fires any timers
+// which are now due.
+func (c *FakeClock) Advance(d time.Duration) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(c.now.Add(d))
+}
+
+// Set moves the fake time to the given time and fires any timers which are
+// now due.
+func (c *FakeClock) Set(now time.Time) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.set(now)
+}
+
+// Timers returns the number of timers which are waiting to fire. Tests can
+// use it to wait until a goroutine has armed its timer before advancing.
+func (c *FakeClock) Timers() int {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.timers)
+}
+
+// set is the unlocked implementation of Set
+func (c *FakeClock) set(now time.Time) {
+
+	c.now = now
+
+	for t := range c.timers {
+		if !now.Before(t.expires) {
+			delete(c.timers, t)
+			t.c <- now
+		}
+	}
+}
+
+// fakeTimer is a Timer created by a FakeClock
+type fakeTimer struct {
+	clock   *FakeClock
+	expires time.Time
+	c       chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.c
+}
+
+func (t *fakeTimer) Stop() bool {
+
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+
+	_, ok := t.clock.timers[t]
+	delete(t.clock.timers, t)
+
+	return ok
+}
@@ -0,0 +1,150 @@
+package flexqueue_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestFakeClock(t *testing.T) {
+
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	clock := flexqueue.NewFakeClock(start)
+
+	timer := clock.NewTimer(time.Second)
+	stopped := clock.NewTimer(time.Second)
+
+	if clock.Timers() != 2 {
+		t.Errorf("expected timer count to be %v but got %v instead", 2, clock.Timers())
+	}
+	if ok := stopped.Stop(); !ok {
+		t.Errorf("expected stop to be ok but got not ok")
+	}
+
+	clock.Advance(time.Millisecond * 999)
+
+	select {
+	case <-timer.C():
+		t.Errorf("expected timer to not fire before it is due")
+	default:
+	}
+
+	clock.Advance(time.Millisecond)
+
+	select {
+	case now := <-timer.C():
+		if !now.Equal(start.Add(time.Second)) {
+			t.Errorf("expected timer to fire at %v but got %v instead", start.Add(time.Second), now)
+		}
+	default:
+		t.Errorf("expected timer to fire once it is due")
+	}
+
+	select {
+	case <-stopped.C():
+		t.Errorf("expected stopped timer to not fire")
+	default:
+	}
+
+	if clock.Timers() != 0 {
+		t.Errorf("expected timer count to be %v but got %v instead", 0, clock.Timers())
+	}
+	if ok := timer.Stop(); ok {
+		t.Errorf("expected stop of fired timer to be not ok but got ok")
+	}
+}
+
+func TestFlexQueueFakeClockTTL(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+
+	expired := []string{}
+	cbFunc := func(digest string, message interface{}) {
+		expired = append(expired, digest)
+	}
+
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Hour, cbFunc)
+	queue.PushBackTTL("B", &Message{Digest: "B"}, time.Hour*2, cbFunc)
+
+	clock.Advance(time.Hour)
+
+	// the ttl is only expired once the clock has moved past it
+	if !queue.Has("A") {
+		t.Errorf("expected message %v to exist", "A")
+	}
+
+	clock.Advance(time.Nanosecond)
+
+	if queue.Has("A") {
+		t.Errorf("expected message %v to not exist", "A")
+	}
+
+	if ok := queue.ResetTTL("B", time.Minute); !ok {
+		t.Errorf("expected reset to be ok but got not ok")
+	}
+
+	clock.Advance(time.Minute * 2)
+
+	if ok := queue.Prune(); !ok {
+		t.Errorf("expected prune to return %v but got %v", true, ok)
+	}
+	if len(expired) != 2 {
+		t.Errorf("expected expired messages to be %v but got %v instead", []string{"A", "B"}, expired)
+	}
+}
+
+func TestFlexQueueFakeClockLease(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+
+	queue.PushBack("A", &Message{Digest: "A"})
+	queue.LeaseFront(time.Minute)
+
+	clock.Advance(time.Second * 59)
+
+	if _, _, ok := queue.ReadFront(); ok {
+		t.Errorf("expected leased message to be hidden")
+	}
+
+	clock.Advance(time.Second)
+
+	if _, digest, _, _ := queue.LeaseFront(time.Minute); digest != "A" {
+		t.Errorf("expected redelivery of %v but got %v instead", "A", digest)
+	}
+}
+
+func TestFlexQueueFakeClockJanitor(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+
+	expired := make(chan string, 1)
+	cbFunc := func(digest string, message interface{}) {
+		expired <- digest
+	}
+
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Hour, cbFunc)
+
+	queue.StartExpiry(context.Background())
+	defer queue.StopExpiry()
+
+	// wait for the janitor to arm its timer for the soonest expiry
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	clock.Advance(time.Hour + time.Nanosecond)
+
+	select {
+	case digest := <-expired:
+		if digest != "A" {
+			t.Errorf("expected expired digest to be %v but got %v instead", "A", digest)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected janitor to fire callback once the clock advanced")
+	}
+}
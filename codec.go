@@ -0,0 +1,27 @@
+package flexqueue
+
+import "encoding/json"
+
+// Codec converts messages to and from bytes so they can be written to a
+// write-ahead log or snapshot.
+type Codec[T any] interface {
+	Encode(message T) ([]byte, error)
+	Decode(data []byte) (T, error)
+}
+
+// JSONCodec is a Codec which uses encoding/json. When T is interface{} the
+// decoded messages will have the generic json types such as map[string]interface{}
+// so a concrete T should be preferred.
+type JSONCodec[T any] struct{}
+
+// Encode marshals the message to json
+func (JSONCodec[T]) Encode(message T) ([]byte, error) {
+	return json.Marshal(message)
+}
+
+// Decode unmarshals the message from json
+func (JSONCodec[T]) Decode(data []byte) (T, error) {
+	var message T
+	err := json.Unmarshal(data, &message)
+	return message, err
+}
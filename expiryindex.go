@@ -0,0 +1,181 @@
+package flexqueue
+
+import (
+	"container/heap"
+	"sort"
+	"time"
+)
+
+// expiryIndex is a table of values keyed by string which are each given an
+// expires time. It combines a map for O(1) lookups with a min-heap ordered by
+// expires time so that the soonest expiry can be found in O(1) and removed
+// in O(log n).
+type expiryIndex[V any] struct {
+	entries map[string]*expiryEntry[V]
+	heap    expiryHeap[V]
+}
+
+// expiryEntry retains the relationship between the heap and the key map
+type expiryEntry[V any] struct {
+	key     string
+	value   V
+	expires time.Time
+	index   int
+}
+
+// newExpiryIndex creates an empty expiry index
+func newExpiryIndex[V any]() expiryIndex[V] {
+	return expiryIndex[V]{
+		entries: make(map[string]*expiryEntry[V]),
+	}
+}
+
+// get will return the value for the key, if it exists
+func (t *expiryIndex[V]) get(key string) (V, bool) {
+
+	if entry, ok := t.entries[key]; ok {
+		return entry.value, true
+	}
+
+	var value V
+	return value, false
+}
+
+// expires will return the expires time for the key, if it exists
+func (t *expiryIndex[V]) expires(key string) (time.Time, bool) {
+
+	if entry, ok := t.entries[key]; ok {
+		return entry.expires, true
+	}
+
+	return time.Time{}, false
+}
+
+// set will add or replace the value and expires time for the key
+func (t *expiryIndex[V]) set(key string, value V, expires time.Time) {
+
+	if entry, ok := t.entries[key]; ok {
+		entry.value = value
+		entry.expires = expires
+		heap.Fix(&t.heap, entry.index)
+		return
+	}
+
+	entry := &expiryEntry[V]{
+		key:     key,
+		value:   value,
+		expires: expires,
+	}
+	t.entries[key] = entry
+	heap.Push(&t.heap, entry)
+}
+
+// delete will remove the value for the key. Returns true if it was found
+// and removed.
+func (t *expiryIndex[V]) delete(key string) bool {
+
+	if entry, ok := t.entries[key]; ok {
+		heap.Remove(&t.heap, entry.index)
+		delete(t.entries, key)
+		return true
+	}
+
+	return false
+}
+
+// peek will return the value with the soonest expires time without removing
+// it. Returns false if the index is empty.
+func (t *expiryIndex[V]) peek() (string, V, time.Time, bool) {
+
+	if len(t.heap) > 0 {
+		entry := t.heap[0]
+		return entry.key, entry.value, entry.expires, true
+	}
+
+	var value V
+	return "", value, time.Time{}, false
+}
+
+// countBefore will count the values whose expires time is before t and for
+// which match returns true. Only the part of the heap holding those values is
+// visited, so the cost grows with the count rather than the index size.
+func (t *expiryIndex[V]) countBefore(before time.Time, match func(key string) bool) int {
+
+	count := 0
+	stack := []int{0}
+
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		// Every child expires no sooner than its parent
+		if i >= len(t.heap) || !t.heap[i].expires.Before(before) {
+			continue
+		}
+		if match == nil || match(t.heap[i].key) {
+			count++
+		}
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+
+	return count
+}
+
+// sorted returns every entry ordered by expires time, with ties ordered by
+// the name of each entry, so that the order does not depend on the map or heap
+// layout. The name is the key unless a name func is given.
+func (t *expiryIndex[V]) sorted(name func(entry *expiryEntry[V]) string) []*expiryEntry[V] {
+
+	if name == nil {
+		name = func(entry *expiryEntry[V]) string {
+			return entry.key
+		}
+	}
+
+	entries := append([]*expiryEntry[V]{}, t.heap...)
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].expires.Equal(entries[j].expires) {
+			return entries[i].expires.Before(entries[j].expires)
+		}
+		return name(entries[i]) < name(entries[j])
+	})
+
+	return entries
+}
+
+// len returns the number of values in the index
+func (t *expiryIndex[V]) len() int {
+	return len(t.heap)
+}
+
+// expiryHeap implements heap.Interface ordered by expires time
+type expiryHeap[V any] []*expiryEntry[V]
+
+func (h expiryHeap[V]) Len() int {
+	return len(h)
+}
+
+func (h expiryHeap[V]) Less(i, j int) bool {
+	return h[i].expires.Before(h[j].expires)
+}
+
+func (h expiryHeap[V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *expiryHeap[V]) Push(x interface{}) {
+	entry := x.(*expiryEntry[V])
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *expiryHeap[V]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	entry := old[n-1]
+	old[n-1] = nil
+	*h = old[:n-1]
+	return entry
+}
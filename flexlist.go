@@ -2,36 +2,51 @@ package flexqueue
 
 import "container/list"
 
-// FlexList is a high performance ordered map that maintains constant amortized
+// List is a high performance ordered map that maintains constant amortized
 // time O(1) for all read/write operations. Internally it uses a combination of
-// a double linked list for item order and a map of strings for an index.
-type FlexList struct {
+// a double linked list for item order and a map of comparable keys for an index.
+type List[K comparable, V any] struct {
 	items   *list.List
-	indices map[string]*list.Element
+	indices map[K]*list.Element
+	format  JSONFormat
+	decoder ItemDecoder[K, V]
 }
 
-// NewFlexList factory func should always be used to instantiate a new FlexList
-func NewFlexList() *FlexList {
-	return &FlexList{
+// FlexList is the original non-generic ordered map keyed by string. It is kept
+// as an alias of List so that existing code continues to compile unchanged.
+type FlexList = List[string, interface{}]
+
+// NewList factory func should always be used to instantiate a new List
+func NewList[K comparable, V any]() *List[K, V] {
+	return &List[K, V]{
 		items:   list.New(),
-		indices: make(map[string]*list.Element),
+		indices: make(map[K]*list.Element),
 	}
 }
 
-// ItemWrapper retains the relationship between the linked list and the index map
-type ItemWrapper struct {
-	index string
-	item  interface{}
+// NewFlexList factory func should always be used to instantiate a new FlexList
+func NewFlexList() *FlexList {
+	return NewList[string, interface{}]()
+}
+
+// itemWrapper retains the relationship between the linked list and the index map
+type itemWrapper[K comparable, V any] struct {
+	index K
+	item  V
 }
 
+// ItemWrapper is the original non-generic item wrapper used by FlexList. It is
+// kept as an alias so that existing code continues to compile unchanged.
+type ItemWrapper = itemWrapper[string, interface{}]
+
 // PushFront will create the index and add the item to the front of the list. If
 // the index already exists then the operation is ignored.
 // Returns:
 // * bool: true if a new item was inserted or false if it already existed
-func (l *FlexList) PushFront(index string, item interface{}) bool {
+func (l *List[K, V]) PushFront(index K, item V) bool {
 
 	if _, ok := l.indices[index]; !ok {
-		l.indices[index] = l.items.PushFront(&ItemWrapper{
+		l.indices[index] = l.items.PushFront(&itemWrapper[K, V]{
 			index: index,
 			item:  item,
 		})
@@ -45,10 +60,10 @@ func (l *FlexList) PushFront(index string, item interface{}) bool {
 // the index already exists then the operation is ignored.
 // Returns:
 // * bool: true if a new item was inserted or false if it already existed
-func (l *FlexList) PushBack(index string, item interface{}) bool {
+func (l *List[K, V]) PushBack(index K, item V) bool {
 
 	if _, ok := l.indices[index]; !ok {
-		l.indices[index] = l.items.PushBack(&ItemWrapper{
+		l.indices[index] = l.items.PushBack(&itemWrapper[K, V]{
 			index: index,
 			item:  item,
 		})
@@ -58,105 +73,163 @@ func (l *FlexList) PushBack(index string, item interface{}) bool {
 	return false
 }
 
+// InsertBefore will create the index and add the item just before the item at
+// the mark index. If the index already exists or the mark does not exist then
+// the operation is ignored.
+// Returns:
+// * bool: true if the item was inserted and false if not
+func (l *List[K, V]) InsertBefore(mark K, index K, item V) bool {
+
+	markItem, ok := l.indices[mark]
+	if !ok || l.Has(index) {
+		return false
+	}
+
+	l.indices[index] = l.items.InsertBefore(&itemWrapper[K, V]{
+		index: index,
+		item:  item,
+	}, markItem)
+
+	return true
+}
+
+// InsertAfter will create the index and add the item just after the item at
+// the mark index. If the index already exists or the mark does not exist then
+// the operation is ignored.
+// Returns:
+// * bool: true if the item was inserted and false if not
+func (l *List[K, V]) InsertAfter(mark K, index K, item V) bool {
+
+	markItem, ok := l.indices[mark]
+	if !ok || l.Has(index) {
+		return false
+	}
+
+	l.indices[index] = l.items.InsertAfter(&itemWrapper[K, V]{
+		index: index,
+		item:  item,
+	}, markItem)
+
+	return true
+}
+
 // PullFront will remove an item from the front of the list and return it.
 // This is an alias for ReadFront() + Remove().
 // Returns:
-// * string: The index of the item
-// * interface{}: The item
+// * K: The index of the item
+// * V: The item
 // * bool: true if an item was found and false for an empty list
-func (l *FlexList) PullFront() (string, interface{}, bool) {
+func (l *List[K, V]) PullFront() (K, V, bool) {
 
 	if index, item, ok := l.ReadFront(); ok {
 		_ = l.Remove(index)
 		return index, item, ok
 	}
 
-	return "", nil, false
+	var (
+		index K
+		item  V
+	)
+	return index, item, false
 }
 
 // PullBack will return an item from the back of the list and then remove it.
 // This is an alias for ReadBack() + Remove().
 // Returns:
-// * string: The index of the item
-// * interface{}: The item
+// * K: The index of the item
+// * V: The item
 // * bool: true if an item was found and false for an empty list
-func (l *FlexList) PullBack() (string, interface{}, bool) {
+func (l *List[K, V]) PullBack() (K, V, bool) {
 
 	if index, item, ok := l.ReadBack(); ok {
 		_ = l.Remove(index)
 		return index, item, ok
 	}
 
-	return "", nil, false
+	var (
+		index K
+		item  V
+	)
+	return index, item, false
 }
 
 // Pull will return an item from the list based on the index and then remove it.
 // This is an alias for Read() + Remove()
 // Returns:
-// * interface{}: The item
+// * V: The item
 // * bool: true if the item was found
-func (l *FlexList) Pull(index string) (interface{}, bool) {
+func (l *List[K, V]) Pull(index K) (V, bool) {
 
 	if item, ok := l.Read(index); ok {
 		_ = l.Remove(index)
 		return item, ok
 	}
 
-	return nil, false
+	var item V
+	return item, false
 }
 
 // ReadFront will return an item from the front of the list without removing it.
 // Returns:
-// * string: The index of the item
-// * interface{}: The item
+// * K: The index of the item
+// * V: The item
 // * bool: true if an item was found and false for an empty list
-func (l *FlexList) ReadFront() (string, interface{}, bool) {
+func (l *List[K, V]) ReadFront() (K, V, bool) {
 
 	if item := l.items.Front(); item != nil {
-		wrapper := item.Value.(*ItemWrapper)
+		wrapper := item.Value.(*itemWrapper[K, V])
 		return wrapper.index, wrapper.item, true
 	}
 
-	return "", nil, false
+	var (
+		index K
+		item  V
+	)
+	return index, item, false
 }
 
 // ReadBack will return an item from the back of the list without removing it.
 // Returns:
-// * string: The index of the item
-// * interface{}: The item
+// * K: The index of the item
+// * V: The item
 // * bool: true if an item was found and false for an empty list
-func (l *FlexList) ReadBack() (string, interface{}, bool) {
+func (l *List[K, V]) ReadBack() (K, V, bool) {
 
 	if item := l.items.Back(); item != nil {
-		wrapper := item.Value.(*ItemWrapper)
+		wrapper := item.Value.(*itemWrapper[K, V])
 		return wrapper.index, wrapper.item, true
 	}
 
-	return "", nil, false
+	var (
+		index K
+		item  V
+	)
+	return index, item, false
 }
 
 // Read will return an item from the list based on the index without removing it.
 // Returns:
-// * interface{}: The item
+// * V: The item
 // * bool: true if the item was found
-func (l *FlexList) Read(index string) (interface{}, bool) {
+func (l *List[K, V]) Read(index K) (V, bool) {
 
 	if item, ok := l.indices[index]; ok {
-		wrapper := item.Value.(*ItemWrapper)
+		wrapper := item.Value.(*itemWrapper[K, V])
 		return wrapper.item, true
 	}
 
-	return nil, false
+	var item V
+	return item, false
 }
 
 // Update will update an item in the list based on its index without changing the
 // order. The operation is ignored if the item does not already exist.
 // Returns:
 // * bool: true if the item was updated and false if not found
-func (l *FlexList) Update(index string, item interface{}) bool {
+func (l *List[K, V]) Update(index K, item V) bool {
 
 	if oldItem, ok := l.indices[index]; ok {
-		l.indices[index] = l.items.InsertAfter(&ItemWrapper{
+		l.indices[index] = l.items.InsertAfter(&itemWrapper[K, V]{
 			index: index,
 			item:  item,
 		}, oldItem)
@@ -170,7 +243,7 @@ func (l *FlexList) Update(index string, item interface{}) bool {
 // Remove will delete an item from the list based on the index.
 // Returns:
 // * bool: true if the item was removed and false if not found
-func (l *FlexList) Remove(index string) bool {
+func (l *List[K, V]) Remove(index K) bool {
 
 	if item, ok := l.indices[index]; ok {
 		_ = l.items.Remove(item)
@@ -181,14 +254,96 @@ func (l *FlexList) Remove(index string) bool {
 	return false
 }
 
+// MoveToFront will move an item to the front of the list without changing it.
+// Returns:
+// * bool: true if the item was moved and false if not found
+func (l *List[K, V]) MoveToFront(index K) bool {
+
+	if item, ok := l.indices[index]; ok {
+		l.items.MoveToFront(item)
+		return true
+	}
+
+	return false
+}
+
+// MoveToBack will move an item to the back of the list without changing it.
+// Returns:
+// * bool: true if the item was moved and false if not found
+func (l *List[K, V]) MoveToBack(index K) bool {
+
+	if item, ok := l.indices[index]; ok {
+		l.items.MoveToBack(item)
+		return true
+	}
+
+	return false
+}
+
+// MoveBefore will move an item to just before the item at the mark index
+// without changing it.
+// Returns:
+// * bool: true if the item was moved and false if either index was not found
+func (l *List[K, V]) MoveBefore(index K, mark K) bool {
+
+	item, ok := l.indices[index]
+	markItem, markOk := l.indices[mark]
+
+	if ok && markOk {
+		l.items.MoveBefore(item, markItem)
+		return true
+	}
+
+	return false
+}
+
+// MoveAfter will move an item to just after the item at the mark index
+// without changing it.
+// Returns:
+// * bool: true if the item was moved and false if either index was not found
+func (l *List[K, V]) MoveAfter(index K, mark K) bool {
+
+	item, ok := l.indices[index]
+	markItem, markOk := l.indices[mark]
+
+	if ok && markOk {
+		l.items.MoveAfter(item, markItem)
+		return true
+	}
+
+	return false
+}
+
 // Has will return true if the list contains the given index and
 // false if it does not.
-func (l *FlexList) Has(index string) bool {
+func (l *List[K, V]) Has(index K) bool {
 	_, ok := l.indices[index]
 	return ok
 }
 
 // Len will return the number of items in the list
-func (l *FlexList) Len() int {
+func (l *List[K, V]) Len() int {
 	return l.items.Len()
 }
+
+// Range will call fn for each item from the front to the back of the list and
+// stops early if fn returns false. The list must not be modified by fn.
+func (l *List[K, V]) Range(fn func(index K, item V) bool) {
+	for e := l.items.Front(); e != nil; e = e.Next() {
+		wrapper := e.Value.(*itemWrapper[K, V])
+		if !fn(wrapper.index, wrapper.item) {
+			return
+		}
+	}
+}
+
+// RangeReverse will call fn for each item from the back to the front of the
+// list and stops early if fn returns false. The list must not be modified by fn.
+func (l *List[K, V]) RangeReverse(fn func(index K, item V) bool) {
+	for e := l.items.Back(); e != nil; e = e.Prev() {
+		wrapper := e.Value.(*itemWrapper[K, V])
+		if !fn(wrapper.index, wrapper.item) {
+			return
+		}
+	}
+}
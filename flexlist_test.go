@@ -10,6 +10,12 @@ type Item struct {
 	ID string
 }
 
+// The original non-generic names must keep compiling
+var (
+	_ *flexqueue.FlexList    = flexqueue.NewFlexList()
+	_ *flexqueue.ItemWrapper = nil
+)
+
 func TestFlexListPushBackPullFront(t *testing.T) {
 
 	items := []Item{
@@ -487,3 +493,165 @@ func TestFlexListRemove(t *testing.T) {
 		t.Errorf("expected list len to be 0 but got %v instead", list.Len())
 	}
 }
+
+func TestListGeneric(t *testing.T) {
+
+	list := flexqueue.NewList[int, Item]()
+
+	for i, id := range []string{"A", "B", "C"} {
+		if ok := list.PushBack(i, Item{ID: id}); !ok {
+			t.Errorf("expected successful push but got failed")
+		}
+	}
+
+	if ok := list.PushFront(1, Item{ID: "X"}); ok {
+		t.Errorf("expected failed push of duplicate index but got success")
+	}
+
+	// items are returned as their concrete type without assertion
+	index, item, ok := list.PullBack()
+	if !ok {
+		t.Errorf("expected successful pull but got failed")
+	}
+	if index != 2 || item.ID != "C" {
+		t.Errorf("expected extracted item to be %v/%v but got %v/%v instead", 2, "C", index, item.ID)
+	}
+
+	if item, ok := list.Read(0); !ok || item.ID != "A" {
+		t.Errorf("expected read item to have id %v but got %v instead", "A", item.ID)
+	}
+
+	list.Remove(0)
+	list.Remove(1)
+
+	// the zero values are returned for an empty list
+	index, item, ok = list.PullFront()
+	if ok {
+		t.Errorf("expected failed pull but got success")
+	}
+	if index != 0 || item.ID != "" {
+		t.Errorf("expected zero values from empty list but got %v/%v instead", index, item)
+	}
+}
+
+func TestListRange(t *testing.T) {
+
+	list := flexqueue.NewList[string, int]()
+	list.PushBack("A", 1)
+	list.PushBack("B", 2)
+	list.PushBack("C", 3)
+
+	tests := []struct {
+		name     string
+		reverse  bool
+		stop     string
+		expected string
+	}{
+		{"forward", false, "", "ABC"},
+		{"reverse", true, "", "CBA"},
+		{"forward stop", false, "B", "AB"},
+		{"reverse stop", true, "B", "CB"},
+	}
+
+	for _, test := range tests {
+		visited := ""
+		fn := func(index string, item int) bool {
+			visited += index
+			return index != test.stop
+		}
+		if test.reverse {
+			list.RangeReverse(fn)
+		} else {
+			list.Range(fn)
+		}
+		if visited != test.expected {
+			t.Errorf("%v: expected visited to be %v but got %v instead", test.name, test.expected, visited)
+		}
+	}
+
+	if list.Len() != 3 {
+		t.Errorf("expected len to be %v but got %v instead", 3, list.Len())
+	}
+}
+
+func TestListMove(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		move     func(list *flexqueue.List[string, int]) bool
+		ok       bool
+		expected string
+	}{
+		{"to front", func(l *flexqueue.List[string, int]) bool { return l.MoveToFront("C") }, true, "CABD"},
+		{"to back", func(l *flexqueue.List[string, int]) bool { return l.MoveToBack("A") }, true, "BCDA"},
+		{"before", func(l *flexqueue.List[string, int]) bool { return l.MoveBefore("D", "B") }, true, "ADBC"},
+		{"after", func(l *flexqueue.List[string, int]) bool { return l.MoveAfter("A", "C") }, true, "BCAD"},
+		{"missing index", func(l *flexqueue.List[string, int]) bool { return l.MoveToFront("X") }, false, "ABCD"},
+		{"missing mark", func(l *flexqueue.List[string, int]) bool { return l.MoveAfter("A", "X") }, false, "ABCD"},
+	}
+
+	for _, test := range tests {
+		list := flexqueue.NewList[string, int]()
+		for i, index := range []string{"A", "B", "C", "D"} {
+			list.PushBack(index, i)
+		}
+
+		if ok := test.move(list); ok != test.ok {
+			t.Errorf("%v: expected move to return %v but got %v instead", test.name, test.ok, ok)
+		}
+
+		order := ""
+		list.Range(func(index string, item int) bool {
+			order += index
+			return true
+		})
+		if order != test.expected {
+			t.Errorf("%v: expected order to be %v but got %v instead", test.name, test.expected, order)
+		}
+	}
+}
+
+func TestListInsert(t *testing.T) {
+
+	list := flexqueue.NewList[string, int]()
+	list.PushBack("A", 1)
+	list.PushBack("C", 3)
+
+	tests := []struct {
+		name  string
+		after bool
+		mark  string
+		index string
+		ok    bool
+	}{
+		{"before", false, "C", "B", true},
+		{"after", true, "C", "D", true},
+		{"before front", false, "A", "0", true},
+		{"duplicate index", true, "A", "C", false},
+		{"missing mark", false, "X", "E", false},
+	}
+
+	for _, test := range tests {
+		var ok bool
+		if test.after {
+			ok = list.InsertAfter(test.mark, test.index, 0)
+		} else {
+			ok = list.InsertBefore(test.mark, test.index, 0)
+		}
+		if ok != test.ok {
+			t.Errorf("%v: expected insert to return %v but got %v instead", test.name, test.ok, ok)
+		}
+	}
+
+	order := ""
+	list.Range(func(index string, item int) bool {
+		order += index
+		return true
+	})
+	if order != "0ABCD" {
+		t.Errorf("expected order to be %v but got %v instead", "0ABCD", order)
+	}
+	if item, _ := list.Read("C"); item != 3 {
+		t.Errorf("expected duplicate insert to leave item %v but got %v instead", 3, item)
+	}
+}
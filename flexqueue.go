@@ -9,47 +9,126 @@ const (
 	NoMax = -1
 )
 
-// FlexQueue is a combined FIFO/LIFO single lane queue with all the features of
-// FlexList but also supporting mutex thread safety, max queue length, message
-// de-duplication and ttl/expiration.
-type FlexQueue struct {
-	sync.RWMutex                // Shared mutex for locking
-	messages     FlexList       // An ordered map of messages
-	ttl          map[string]TTL // A table of TTL controls keyed by digest
-	max          int            // The max queue length
-}
-
-// TTL is an expiration control that applies to a single message.
-type TTL struct {
+// Queue is a combined FIFO/LIFO single lane queue with all the features of
+// List but also supporting mutex thread safety, max queue length, message
+// de-duplication and ttl/expiration. Messages are keyed by a string digest
+// and carry a payload of type T.
+type Queue[T any] struct {
+	sync.RWMutex                            // Shared mutex for locking
+	messages     List[string, T]            // An ordered map of messages
+	ttl          expiryIndex[TTLControl[T]] // A table of TTL controls keyed by digest and ordered by expiry
+	leases       expiryIndex[*lease[T]]     // Leased messages keyed by receipt and ordered by visibility timeout
+	leased       map[string]string          // Lease receipts keyed by digest
+	delayed      expiryIndex[T]             // Messages keyed by digest and ordered by the time they become visible
+	attempts     map[string]int             // Delivery attempt counts keyed by digest
+	maxAttempts  int                        // The max delivery attempts before dead-lettering
+	dlq          *Queue[T]                  // The dead-letter queue, if configured
+	deadLetters  map[string]deadLetter[T]   // Dead-letter details keyed by digest
+	max          int                        // The max queue length
+	overflow     OverflowPolicy             // What to do when pushing to a full queue
+	ttlAware     bool                       // True if capacity checks discount expired messages
+	onEvict      EvictFunc[T]               // Called for messages evicted by the overflow policy
+	dedup        DedupPolicy                // What to do when pushing a duplicate digest
+	observers    []observer[T]              // Registered event observers
+	observerID   int                        // The id of the last registered observer
+	deferred     []func()                   // Work to run once the lock is released
+	dispatcher   Dispatcher                 // Runs the deferred work, if set
+	metrics      *metrics                   // Counters and timings, if enabled
+	recent       expiryIndex[struct{}]      // Digests which recently left the queue, ordered by when they are forgotten
+	window       time.Duration              // How long digests are remembered after leaving the queue
+	windowSize   int                        // The max number of digests remembered
+	closed       bool                       // True once the queue has been closed
+	pullWaiters  waitList                   // Callers blocked waiting for a message
+	pushWaiters  waitList                   // Callers blocked waiting for free space
+	janitor      *janitor                   // The background expiry goroutine, if started
+	wal          *writeAheadLog[T]          // The write-ahead log, if the queue is durable
+	clock        Clock                      // The source of time for ttl and lease timing
+	codec        Codec[T]                   // Converts messages to bytes for logs and snapshots
+}
+
+// FlexQueue is the original non-generic queue carrying interface{} messages.
+// It is kept as an alias of Queue so that existing code continues to compile
+// unchanged.
+type FlexQueue = Queue[interface{}]
+
+// ExpiryFunc is the signature of a TTL expiration callback.
+type ExpiryFunc[T any] func(digest string, message T)
+
+// TTLControl is an expiration control that applies to a single message.
+type TTLControl[T any] struct {
 	Expires  time.Time
-	Callback func(digest string, message interface{})
+	Callback ExpiryFunc[T]
 }
 
+// TTL is the original non-generic expiration control used by FlexQueue.
+type TTL = TTLControl[interface{}]
+
 // Expired will check the ttl expires time against now and return true if it
 // is expired and false if not.
-func (ttl *TTL) Expired() bool {
-	return time.Now().After(ttl.Expires)
+func (ttl *TTLControl[T]) Expired() bool {
+	return ttl.ExpiredAt(time.Now())
 }
 
-// NewTTL creates a new TTL control for the duration based on now
-func NewTTL(ttl time.Duration, callback func(digest string, message interface{})) *TTL {
-	return &TTL{
+// ExpiredAt will check the ttl expires time against the given time and return
+// true if it is expired and false if not.
+func (ttl *TTLControl[T]) ExpiredAt(now time.Time) bool {
+	return now.After(ttl.Expires)
+}
+
+// NewTTLControl creates a new TTL control for the duration based on now
+func NewTTLControl[T any](ttl time.Duration, callback ExpiryFunc[T]) *TTLControl[T] {
+	return &TTLControl[T]{
 		Expires:  time.Now().Add(ttl),
 		Callback: callback,
 	}
 }
 
+// NewTTL creates a new TTL control for the duration based on now
+func NewTTL(ttl time.Duration, callback func(digest string, message interface{})) *TTL {
+	return NewTTLControl[interface{}](ttl, callback)
+}
+
+// NewQueue is a factory method for creating a new queue. It is important to
+// use this method to properly initialize the internal structs.
+func NewQueue[T any]() *Queue[T] {
+	return NewQueueWithClock[T](SystemClock{})
+}
+
+// NewQueueWithClock is a factory method for creating a new queue which uses
+// the given clock for all TTL and lease timing, such as a FakeClock in tests.
+func NewQueueWithClock[T any](clock Clock) *Queue[T] {
+	return &Queue[T]{
+		clock:       clock,
+		codec:       JSONCodec[T]{},
+		messages:    *NewList[string, T](),
+		ttl:         newExpiryIndex[TTLControl[T]](),
+		leases:      newExpiryIndex[*lease[T]](),
+		leased:      make(map[string]string),
+		delayed:     newExpiryIndex[T](),
+		recent:      newExpiryIndex[struct{}](),
+		windowSize:  DefaultDedupWindowSize,
+		attempts:    make(map[string]int),
+		maxAttempts: NoMax,
+		deadLetters: make(map[string]deadLetter[T]),
+		max:         NoMax,
+		pullWaiters: newWaitList(),
+		pushWaiters: newWaitList(),
+	}
+}
+
 // NewFlexQueue is a factory method for creating a new flex queue. It is
 // important to use this method to properly initialize the internal structs.
 func NewFlexQueue() *FlexQueue {
-	return &FlexQueue{
-		messages: *NewFlexList(),
-		ttl:      make(map[string]TTL),
-		max:      NoMax,
-	}
+	return NewQueue[interface{}]()
+}
+
+// NewFlexQueueWithClock is a factory method for creating a new flex queue
+// which uses the given clock for all TTL and lease timing.
+func NewFlexQueueWithClock(clock Clock) *FlexQueue {
+	return NewQueueWithClock[interface{}](clock)
 }
 
-func (q *FlexQueue) SetMax(max int) *FlexQueue {
+func (q *Queue[T]) SetMax(max int) *Queue[T] {
 	if max > NoMax {
 		q.max = max
 	}
@@ -59,126 +138,218 @@ func (q *FlexQueue) SetMax(max int) *FlexQueue {
 // PushFront will add a new message to the front of the queue. It returns true
 // if the message was added or if it already existed in the queue based on
 // the digest value (automatic de-duping), and false if the message was
-// not added because the queue was full. If de-dupe occurs then the message will
-// not be updated.
-func (q *FlexQueue) PushFront(digest string, message interface{}) bool {
+// not added because the queue was full. If de-dupe occurs then by default the
+// message will not be updated, see SetDedupPolicy to change this. See
+// SetOverflowPolicy to change how a full queue is handled.
+func (q *Queue[T]) PushFront(digest string, message T) bool {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
-	return q.pushFB(true, digest, message)
+	return q.pushFB(true, digest, message).ok()
 }
 
 // PushBack will add a new message to the end of the queue. It returns true
 // if the message was added or if it already existed in the queue based on
 // the digest value (automatic de-duping), and false if the message was
-// not added because the queue was full. If de-dupe occurs then the message will
-// not be updated.
-func (q *FlexQueue) PushBack(digest string, message interface{}) bool {
+// not added because the queue was full. If de-dupe occurs then by default the
+// message will not be updated, see SetDedupPolicy to change this. See
+// SetOverflowPolicy to change how a full queue is handled.
+func (q *Queue[T]) PushBack(digest string, message T) bool {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
-	return q.pushFB(false, digest, message)
+	return q.pushFB(false, digest, message).ok()
 }
 
 // pushFB will push a message into the queue unless it is full
-func (q *FlexQueue) pushFB(front bool, digest string, message interface{}) bool {
+func (q *Queue[T]) pushFB(front bool, digest string, message T) PushResult {
+	return q.push(front, digest, message, nil)
+}
 
-	// Job de-duplication: Just return true now if the digest already exists
-	// in the message list. Its important to perform this check before the limit
-	// check otherwise de-dupes could still return false if the queue is full.
-	if q.messages.Has(digest) {
-		return true
+// push will push a message into the queue unless it is full, and attach the
+// ttl control to it if one is given
+func (q *Queue[T]) push(front bool, digest string, message T, ctrl *TTLControl[T]) PushResult {
+	if front {
+		return q.pushAt(opPushFront, "", digest, message, ctrl, q.dedup)
 	}
+	return q.pushAt(opPushBack, "", digest, message, ctrl, q.dedup)
+}
 
-	// Disallow the push if the queue is already full
-	if q.max > NoMax && q.messages.Len() >= q.max {
-		return false
+// pushAt will push a message into the queue unless it is full. The position is
+// given by the push front or back op, or by the move before or after op along
+// with the mark digest, which the caller must have checked is in the list. A
+// duplicate digest is handled by the dedup policy.
+func (q *Queue[T]) pushAt(op byte, mark string, digest string, message T, ctrl *TTLControl[T], policy DedupPolicy) PushResult {
+
+	if res := q.admit(digest, message, ctrl, policy); res != PushInserted {
+		return res
 	}
 
-	var ok bool
+	// If the overflow policy evicted the mark then the message takes its place
+	// at the end of the queue it was evicted from
+	if (op == opMoveBefore || op == opMoveAfter) && !q.messages.Has(mark) {
+		if q.overflow == OverflowDropFront {
+			op = opPushFront
+		} else {
+			op = opPushBack
+		}
+	}
 
 	// The last thing we do is add the message to the list
-	if front {
-		ok = q.messages.PushFront(digest, message)
-	} else {
-		ok = q.messages.PushBack(digest, message)
+	switch op {
+	case opPushFront:
+		_ = q.messages.PushFront(digest, message)
+	case opPushBack:
+		_ = q.messages.PushBack(digest, message)
+	case opMoveBefore:
+		_ = q.messages.InsertBefore(mark, digest, message)
+	case opMoveAfter:
+		_ = q.messages.InsertAfter(mark, digest, message)
 	}
 
-	return ok
+	if ctrl != nil {
+		q.ttl.set(digest, *ctrl, ctrl.Expires)
+		q.expiryChanged()
+	}
+
+	// An insert is logged as a push to the back followed by a move
+	q.logPush(op == opPushFront, digest, message, ctrl)
+	if op == opMoveBefore || op == opMoveAfter {
+		q.logMove(op, digest, mark)
+	}
+
+	q.emit(EventPushed, digest, message)
+
+	// Hand the new message to the longest waiting puller, if any
+	q.pullWaiters.signal()
+
+	return PushInserted
+}
+
+// admit will check a push against the de-duplication, closed and max length
+// rules shared by every push, applying the dedup policy to a duplicate digest
+// and the overflow policy to a full queue. Returns PushInserted if the caller
+// should add the message, otherwise the reason it must not be added.
+func (q *Queue[T]) admit(digest string, message T, ctrl *TTLControl[T], policy DedupPolicy) PushResult {
+
+	// Job de-duplication: Apply the dedup policy and return now if the digest
+	// already exists in the message list or is leased or delayed. Its
+	// important to perform this check before the limit check otherwise
+	// de-dupes could still be rejected if the queue is full.
+	if q.contains(digest) {
+		q.emit(EventDeduplicated, digest, message)
+		q.dedupe(policy, digest, message, ctrl)
+		return PushDuplicate
+	}
+
+	// Digests which left the queue within the dedup window are also de-duped
+	if q.isRecent(digest) {
+		q.emit(EventDeduplicated, digest, message)
+		return PushRecent
+	}
+
+	// Disallow the push if the queue has been closed
+	if q.closed {
+		return PushClosed
+	}
+
+	// Disallow the push if the queue is already full and the overflow policy
+	// can not make room for it
+	if q.isFull() && !q.makeRoom() {
+		q.emit(EventRejectedFull, digest, message)
+		return PushFull
+	}
+
+	return PushInserted
 }
 
 // PushFrontTTL will add a new message to the front of the queue. It behaves
 // identical to PushFront expect that it attaches a TTL and expiration callback
 // to the message.
-func (q *FlexQueue) PushFrontTTL(digest string, message interface{}, ttl time.Duration, callback func(digest string, message interface{})) bool {
+func (q *Queue[T]) PushFrontTTL(digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) bool {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
-	return q.pushFBTTL(true, digest, message, ttl, callback)
+	return q.pushFBTTL(true, digest, message, ttl, callback).ok()
 }
 
 // PushBackTTL will add a new message to the back of the queue. It behaves
 // identical to PushBack expect that it attaches a TTL and expiration callback
 // to the message.
-func (q *FlexQueue) PushBackTTL(digest string, message interface{}, ttl time.Duration, callback func(digest string, message interface{})) bool {
+func (q *Queue[T]) PushBackTTL(digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) bool {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
-	return q.pushFBTTL(false, digest, message, ttl, callback)
+	return q.pushFBTTL(false, digest, message, ttl, callback).ok()
 }
 
 // pushFBTTL will push a message into the queue like push, and also create
 // a ttl table entry
-func (q *FlexQueue) pushFBTTL(front bool, digest string, message interface{}, ttl time.Duration, callback func(digest string, message interface{})) bool {
+func (q *Queue[T]) pushFBTTL(front bool, digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) PushResult {
 
 	// Create the ttl control and abort now if the ttl is already expired
-	ctrl := NewTTL(ttl, callback)
-	if ctrl.Expired() {
-		ctrl.Callback(digest, message)
-		return false
+	ctrl, ok := q.liveTTL(digest, message, ttl, callback)
+	if !ok {
+		return PushExpired
 	}
 
-	// Pass through to the push operation
-	if ok := q.pushFB(front, digest, message); ok {
-		// If the push was successful then add the ctrl to the ttl table
-		q.ttl[digest] = *ctrl
-		return true
+	// Pass through to the push operation. Only a newly inserted message gets
+	// the ttl unless the dedup policy extends the existing ttl.
+	return q.push(front, digest, message, ctrl)
+}
+
+// liveTTL creates a ttl control for a push. If the ttl is already expired
+// then the callback is fired and false is returned.
+func (q *Queue[T]) liveTTL(digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) (*TTLControl[T], bool) {
+
+	ctrl := q.newTTL(ttl, callback)
+	if ctrl.ExpiredAt(q.clock.Now()) {
+		q.expired(ctrl.Callback, digest, message)
+		return nil, false
 	}
 
-	return false
+	return ctrl, true
 }
 
 // Pull will return the message with the given digest and remove it from the queue.
 // Messages with an expired ttl are automatically removed.
 // Returns:
-// * interface{}: The message
+// * T: The message
 // * bool: true if a message was found or false if not found or expired/removed
-func (q *FlexQueue) Pull(digest string) (interface{}, bool) {
+func (q *Queue[T]) Pull(digest string) (T, bool) {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	if q.pruneMessage(digest) {
-		return nil, false
+		var message T
+		return message, false
+	}
+
+	message, ok := q.messages.Pull(digest)
+	if ok {
+		q.forget(digest)
+		q.freed()
+		q.emit(EventPulled, digest, message)
 	}
 
-	return q.messages.Pull(digest)
+	return message, ok
 }
 
 // PullFront will remove a message from the beginning of the queue and return a
 // reference to it. Messages with an expired ttl are automatically removed.
 // Returns:
 // * string: The message digest
-// * interface{}: The message
+// * T: The message
 // * bool: true if a message was found or false if empty queue
-func (q *FlexQueue) PullFront() (string, interface{}, bool) {
+func (q *Queue[T]) PullFront() (string, T, bool) {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	return q.pullFB(true)
 }
@@ -187,95 +358,123 @@ func (q *FlexQueue) PullFront() (string, interface{}, bool) {
 // reference to it. Messages with an expired ttl are automatically removed.
 // Returns:
 // * string: The message digest
-// * interface{}: The message
+// * T: The message
 // * bool: true if a message was found or false if empty queue
-func (q *FlexQueue) PullBack() (string, interface{}, bool) {
+func (q *Queue[T]) PullBack() (string, T, bool) {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	return q.pullFB(false)
 }
 
 // pullFB is a recursive function that will continue to peel messages off
 // the queue until it finds one that has not expired or the queue is empty
-func (q *FlexQueue) pullFB(front bool) (string, interface{}, bool) {
+func (q *Queue[T]) pullFB(front bool) (string, T, bool) {
+
+	q.reclaimLeases()
+	q.release()
 
 	var (
 		digest  string
-		message interface{}
+		message T
 		ok      bool
 	)
 
 	if front {
-		digest, message, ok = q.messages.PullFront()
+		digest, message, ok = q.messages.ReadFront()
 	} else {
-		digest, message, ok = q.messages.PullBack()
+		digest, message, ok = q.messages.ReadBack()
 	}
 
 	if !ok {
-		return "", nil, false
+		return "", message, false
 	}
 
 	if q.pruneMessage(digest) {
 		return q.pullFB(front)
 	}
 
+	_ = q.messages.Remove(digest)
+	q.forget(digest)
+	q.freed()
+	q.emit(EventPulled, digest, message)
+
 	return digest, message, true
 }
 
 // Read will return the message with the given digest without removing it.
 // Messages with an expired ttl are automatically removed.
 // Returns:
-// * interface{}: The message
+// * T: The message
 // * bool: true if a message was found or false if not found or expired/removed
-func (q *FlexQueue) Read(digest string) (interface{}, bool) {
+func (q *Queue[T]) Read(digest string) (T, bool) {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	if q.pruneMessage(digest) {
-		return nil, false
+		var message T
+		return message, false
 	}
 
-	return q.messages.Read(digest)
+	message, ok := q.messages.Read(digest)
+	if ok {
+		q.emit(EventRead, digest, message)
+	}
+
+	return message, ok
 }
 
 // ReadFront will return a message from the beginning of the queue without
 // removing it. Messages with an expired ttl are automatically removed.
 // Returns:
 // * string: The message digest
-// * interface{}: The message
+// * T: The message
 // * bool: true if a message was found or false if empty queue
-func (q *FlexQueue) ReadFront() (string, interface{}, bool) {
+func (q *Queue[T]) ReadFront() (string, T, bool) {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
-	return q.readFB(true)
+	return q.readEmit(true)
 }
 
 // ReadBack will return a message from the end of the queue without
 // removing it. Messages with an expired ttl are automatically removed.
 // Returns:
 // * string: The message digest
-// * interface{}: The message
+// * T: The message
 // * bool: true if a message was found or false if empty queue
-func (q *FlexQueue) ReadBack() (string, interface{}, bool) {
+func (q *Queue[T]) ReadBack() (string, T, bool) {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
-	return q.readFB(false)
+	return q.readEmit(false)
+}
+
+// readEmit will read a message like readFB and raise a read event for it
+func (q *Queue[T]) readEmit(front bool) (string, T, bool) {
+
+	digest, message, ok := q.readFB(front)
+	if ok {
+		q.emit(EventRead, digest, message)
+	}
+
+	return digest, message, ok
 }
 
 // readFB is a recursive function that will continue to readFB messages off
 // the queue until it finds one that has not expired or the queue is empty
-func (q *FlexQueue) readFB(front bool) (string, interface{}, bool) {
+func (q *Queue[T]) readFB(front bool) (string, T, bool) {
+
+	q.reclaimLeases()
+	q.release()
 
 	var (
 		digest  string
-		message interface{}
+		message T
 		ok      bool
 	)
 
@@ -286,7 +485,7 @@ func (q *FlexQueue) readFB(front bool) (string, interface{}, bool) {
 	}
 
 	if !ok {
-		return "", nil, false
+		return "", message, false
 	}
 
 	if q.pruneMessage(digest) {
@@ -300,26 +499,32 @@ func (q *FlexQueue) readFB(front bool) (string, interface{}, bool) {
 // without changing the order.
 // Returns:
 // * bool: true if the item was updated and false if not found
-func (q *FlexQueue) Update(digest string, message interface{}) bool {
+func (q *Queue[T]) Update(digest string, message T) bool {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	if q.pruneMessage(digest) {
 		return false
 	}
 
-	return q.messages.Update(digest, message)
+	if q.messages.Update(digest, message) {
+		q.logUpdate(digest, message)
+		q.emit(EventUpdated, digest, message)
+		return true
+	}
+
+	return false
 }
 
 // ResetTTL will update the TTL for a message already in the queue with a new duration.
 // The callback for the existing TTL will be kept in place.
 // Returns:
 // * bool: true if the item was updated and false if message not found or TTL not found on message
-func (q *FlexQueue) ResetTTL(digest string, ttl time.Duration) bool {
+func (q *Queue[T]) ResetTTL(digest string, ttl time.Duration) bool {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	// Do not allow reset if the ttl for the targetted message is already expired
 	if q.pruneMessage(digest) {
@@ -327,7 +532,7 @@ func (q *FlexQueue) ResetTTL(digest string, ttl time.Duration) bool {
 	}
 
 	// Grab the current ttl control for the message, if it has one
-	oldCtrl, ok := q.ttl[digest]
+	oldCtrl, ok := q.ttl.get(digest)
 	if !ok {
 		return false
 	}
@@ -335,56 +540,76 @@ func (q *FlexQueue) ResetTTL(digest string, ttl time.Duration) bool {
 	// Create the new ttl control using the old ttl callback,
 	// and abort now if the new ttl is already expired
 	msg, _ := q.messages.Read(digest)
-	ctrl := NewTTL(ttl, oldCtrl.Callback)
-	if ctrl.Expired() {
-		ctrl.Callback(digest, msg)
+	ctrl := q.newTTL(ttl, oldCtrl.Callback)
+	if ctrl.ExpiredAt(q.clock.Now()) {
+		q.expired(ctrl.Callback, digest, msg)
 		return false
 	}
 
 	// Replace the current ttl ctrl with the new one
-	q.ttl[digest] = *ctrl
+	q.ttl.set(digest, *ctrl, ctrl.Expires)
+	q.expiryChanged()
+	q.logResetTTL(digest, ctrl.Expires)
+	q.emit(EventTTLReset, digest, msg)
 
 	return true
 }
 
-// Remove will delete the message from the queue. Returns true if the
-// message was found and deleted or false if not found.
-func (q *FlexQueue) Remove(digest string) bool {
+// Remove will delete the message from the queue, including a message which is
+// currently leased. Returns true if the message was found and deleted or false
+// if not found.
+func (q *Queue[T]) Remove(digest string) bool {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	if q.pruneMessage(digest) {
 		return false
 	}
 
-	if q.messages.Remove(digest) {
-		delete(q.ttl, digest)
-		return true
+	message, ok := q.dropLease(digest)
+	if !ok {
+		message, ok = q.messages.Pull(digest)
+	}
+	if !ok {
+		message, ok = q.delayed.get(digest)
 	}
 
-	return false
+	if ok {
+		q.forget(digest)
+		q.freed()
+		q.emit(EventRemoved, digest, message)
+	}
+
+	return ok
 }
 
-// Prune will scan all messages and remove any with an expired ttl. This
-// function is meant to be used on an interval by the caller in the case that
-// the automatic removal of expired messages by Pull, Read, or Has methods is
-// insufficient. Returns true if any expired messages were found and removed.
-func (q *FlexQueue) Prune() bool {
+// Prune will remove all messages with an expired ttl. This function is meant
+// to be used on an interval by the caller in the case that the automatic
+// removal of expired messages by Pull, Read, or Has methods is insufficient.
+// See StartExpiry for a background alternative. The ttl table is ordered by
+// expiry so only the expired messages are visited, and their callbacks fire in
+// expiry order. Returns true if any expired messages were found and removed.
+func (q *Queue[T]) Prune() bool {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
+
+	return q.prune()
+}
+
+// prune is the unlocked implementation of Prune
+func (q *Queue[T]) prune() bool {
 
 	removed := false
 
-	for digest, ttl := range q.ttl {
-		if ttl.Expired() {
-			msg, _ := q.messages.Read(digest)
-			ttl.Callback(digest, msg)
-			_ = q.messages.Remove(digest)
-			delete(q.ttl, digest)
-			removed = true
+	for {
+		digest, ttl, _, ok := q.ttl.peek()
+		if !ok || !ttl.ExpiredAt(q.clock.Now()) {
+			break
 		}
+		q.expireMessage(digest, ttl)
+		removed = true
 	}
 
 	return removed
@@ -393,36 +618,71 @@ func (q *FlexQueue) Prune() bool {
 // pruneMessage will test for the message ttl and if it exists and is expired then
 // the ttl callback will be fired and the message will be removed from the queue.
 // Returns true if the message message was expired, otherwise false.
-func (q *FlexQueue) pruneMessage(digest string) bool {
-
-	ttl, ok := q.ttl[digest]
-	if ok && ttl.Expired() {
-		msg, _ := q.messages.Read(digest)
-		ttl.Callback(digest, msg)
-		_ = q.messages.Remove(digest)
-		delete(q.ttl, digest)
+func (q *Queue[T]) pruneMessage(digest string) bool {
+
+	ttl, ok := q.ttl.get(digest)
+	if ok && ttl.ExpiredAt(q.clock.Now()) {
+		q.expireMessage(digest, ttl)
 		return true
 	}
 
 	return false
 }
 
-// Has returns true if the message with the given digest is in the queue.
-// Expired messages will be removed and this will return false.
-func (q *FlexQueue) Has(digest string) bool {
+// expireMessage will fire the ttl callback and remove the message and its
+// ttl control from the queue. Messages which expire while leased are removed
+// along with their lease.
+func (q *Queue[T]) expireMessage(digest string, ttl TTLControl[T]) {
+
+	msg, ok := q.messages.Read(digest)
+	if !ok {
+		msg, ok = q.dropLease(digest)
+	}
+	if !ok {
+		msg, ok = q.delayed.get(digest)
+	}
+	q.expired(ttl.Callback, digest, msg)
+	if q.messages.Remove(digest) || ok {
+		q.freed()
+	}
+	q.forget(digest)
+	q.emit(EventExpired, digest, msg)
+}
+
+// Has returns true if the message with the given digest is in the queue,
+// including messages which are currently leased or delayed. Expired messages
+// will be removed and this will return false.
+func (q *Queue[T]) Has(digest string) bool {
 
 	q.Lock()
-	defer q.Unlock()
+	defer q.unlock()
 
 	if q.pruneMessage(digest) {
 		return false
 	}
 
-	return q.messages.Has(digest)
+	return q.contains(digest)
+}
+
+// contains returns true if the digest is in the message list, is leased or
+// is delayed
+func (q *Queue[T]) contains(digest string) bool {
+
+	if q.messages.Has(digest) {
+		return true
+	}
+
+	if _, ok := q.leased[digest]; ok {
+		return true
+	}
+
+	_, ok := q.delayed.get(digest)
+
+	return ok
 }
 
 // Len returns the number of messages currently in the queue
-func (q *FlexQueue) Len() int {
+func (q *Queue[T]) Len() int {
 
 	q.RLock()
 	defer q.RUnlock()
@@ -430,29 +690,86 @@ func (q *FlexQueue) Len() int {
 	return q.messages.Len()
 }
 
+// LiveLen returns the number of messages currently in the queue which have not
+// expired. Unlike calling Prune before Len it does not remove anything, and only
+// the expired part of the ttl index is visited.
+func (q *Queue[T]) LiveLen() int {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	return q.messages.Len() - q.ttl.countBefore(q.clock.Now(), q.messages.Has)
+}
+
 // Max returns the maximum number of messages the queue can hold. If there
 // is no message limit then this will return -1.
-func (q *FlexQueue) Max() int {
+func (q *Queue[T]) Max() int {
 	if q.max > NoMax {
 		return q.max
 	}
 	return NoMax
 }
 
-// IsFull returns true if the queue is full and false if its not
-func (q *FlexQueue) IsFull() bool {
+// IsFull returns true if the queue is full and false if its not. See
+// SetTTLAwareCapacity to leave expired messages out of the count.
+func (q *Queue[T]) IsFull() bool {
 
 	q.RLock()
 	defer q.RUnlock()
 
-	return q.max > NoMax && q.messages.Len() >= q.max
+	if q.ttlAware && q.max > NoMax {
+		expired := q.ttl.countBefore(q.clock.Now(), nil)
+		return q.messages.Len()+q.leases.len()+q.delayed.len()-expired >= q.max
+	}
+
+	return q.isFull()
+}
+
+// isFull is the unlocked implementation of IsFull. Leased messages count
+// towards the max queue length since they may be returned to the queue.
+func (q *Queue[T]) isFull() bool {
+	return q.max > NoMax && q.messages.Len()+q.leases.len()+q.delayed.len() >= q.max
+}
+
+// newTTL creates a new TTL control for the duration based on the queue clock
+func (q *Queue[T]) newTTL(ttl time.Duration, callback ExpiryFunc[T]) *TTLControl[T] {
+	return &TTLControl[T]{
+		Expires:  q.clock.Now().Add(ttl),
+		Callback: callback,
+	}
+}
+
+// forget will clear the per-message state kept alongside a message which has
+// left the queue, and then log the remove.
+func (q *Queue[T]) forget(digest string) {
+	_ = q.ttl.delete(digest)
+	_ = q.delayed.delete(digest)
+	delete(q.attempts, digest)
+	delete(q.deadLetters, digest)
+	q.logRemove(digest)
+	q.remember(digest)
+
+	if q.metrics != nil {
+		q.metrics.left(digest, q.clock.Now())
+	}
+}
+
+// freed must be called whenever a message leaves the queue so that the
+// longest waiting producer, if any, can use the free space.
+func (q *Queue[T]) freed() {
+	q.pushWaiters.signal()
 }
 
-// IsEmpty returns true if the queue is empty and false if its not
-func (q *FlexQueue) IsEmpty() bool {
+// IsEmpty returns true if the queue is empty and false if its not. See
+// SetTTLAwareCapacity to leave expired messages out of the count.
+func (q *Queue[T]) IsEmpty() bool {
 
 	q.RLock()
 	defer q.RUnlock()
 
+	if q.ttlAware {
+		return q.messages.Len() == q.ttl.countBefore(q.clock.Now(), q.messages.Has)
+	}
+
 	return q.messages.Len() == 0
 }
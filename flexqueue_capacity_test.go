@@ -0,0 +1,111 @@
+package flexqueue_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueLiveLen(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock)
+
+	cbCount := 0
+	cbFunc := func(digest string, message Message) {
+		cbCount++
+	}
+
+	// A leased message is not counted
+	queue.PushBack("X", Message{Digest: "X"})
+	queue.LeaseFront(time.Hour)
+
+	// Interleave the expiry times so the expired messages are spread through
+	// the ttl heap
+	for i := 0; i < 100; i++ {
+		digest := fmt.Sprintf("M%v", i)
+		queue.PushBackTTL(digest, Message{Digest: digest}, time.Duration(i%10+1)*time.Second, cbFunc)
+	}
+
+	tests := []struct {
+		advance  time.Duration
+		expected int
+	}{
+		{0, 100},
+		{time.Millisecond * 1500, 90},
+		{time.Second * 5, 40},
+		{time.Minute, 0},
+	}
+
+	for _, test := range tests {
+		clock.Advance(test.advance)
+		if n := queue.LiveLen(); n != test.expected {
+			t.Errorf("expected live len after %v to be %v but got %v instead", test.advance, test.expected, n)
+		}
+	}
+
+	// LiveLen does not remove anything
+	if queue.Len() != 100 || cbCount != 0 {
+		t.Errorf("expected len 100 and no callbacks but got %v and %v instead", queue.Len(), cbCount)
+	}
+}
+
+func TestQueueTTLAwareCapacity(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+
+	for _, aware := range []bool{false, true} {
+
+		queue := flexqueue.NewQueueWithClock[Message](clock).SetMax(2).SetTTLAwareCapacity(aware)
+
+		expired := 0
+		cbFunc := func(digest string, message Message) {
+			expired++
+		}
+
+		queue.PushBackTTL("A", Message{Digest: "A"}, time.Second, cbFunc)
+		queue.PushBackTTL("B", Message{Digest: "B"}, time.Second, cbFunc)
+		clock.Advance(time.Second * 2)
+
+		if queue.IsFull() == aware {
+			t.Errorf("aware %v: expected full to be %v", aware, !aware)
+		}
+		if queue.IsEmpty() != aware {
+			t.Errorf("aware %v: expected empty to be %v", aware, aware)
+		}
+		if ok := queue.PushBack("C", Message{Digest: "C"}); ok != aware {
+			t.Errorf("aware %v: expected push to return %v but got %v instead", aware, aware, ok)
+		}
+		if aware && (expired != 2 || queue.Len() != 1) {
+			t.Errorf("expected the expired backlog to be pruned but got %v callbacks and len %v", expired, queue.Len())
+		}
+	}
+}
+
+func TestQueueTTLAwareCapacityEviction(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock).
+		SetMax(2).
+		SetOverflowPolicy(flexqueue.OverflowDropFront).
+		SetTTLAwareCapacity(true)
+
+	evicted := []string{}
+	queue.SetEvictionCallback(func(digest string, message Message) {
+		evicted = append(evicted, digest)
+	})
+
+	cbFunc := func(digest string, message Message) {}
+
+	// The live message at the front is kept since the expired one makes room
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBackTTL("B", Message{Digest: "B"}, time.Second, cbFunc)
+	clock.Advance(time.Second * 2)
+	queue.PushBack("C", Message{Digest: "C"})
+
+	if len(evicted) != 0 || !queue.Has("A") {
+		t.Errorf("expected no evictions but got %v instead", evicted)
+	}
+}
@@ -0,0 +1,198 @@
+package flexqueue
+
+import "sync"
+
+// deadLetterMu serializes SetDeadLetter so that concurrent calls can not form
+// a cycle of dead-letter queues
+var deadLetterMu sync.Mutex
+
+// DeadLetterInfo describes why a message was moved to a dead-letter queue
+type DeadLetterInfo struct {
+	Digest   string // The original message digest
+	Attempts int    // The number of delivery attempts made
+	Reason   error  // The reason the last delivery attempt failed, if known
+}
+
+// deadLetter retains the queue a message was dead-lettered from
+type deadLetter[T any] struct {
+	info   DeadLetterInfo
+	source *Queue[T]
+}
+
+// SetMaxAttempts sets the number of times a message may be leased before a
+// failed delivery moves it to the dead-letter queue rather than back to the
+// front of the queue. If no dead-letter queue is set then the message is
+// dropped instead. Use NoMax to allow unlimited attempts, which is the default.
+func (q *Queue[T]) SetMaxAttempts(max int) *Queue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	if max > NoMax {
+		q.maxAttempts = max
+	} else {
+		q.maxAttempts = NoMax
+	}
+	return q
+}
+
+// SetDeadLetter sets the queue which receives messages that have reached the
+// max delivery attempts. The dead-letter queue keeps the original digest along
+// with the details returned by DeadLetter. A queue can not be its own
+// dead-letter queue, directly or through the dead-letter queues of other
+// queues, so such a queue is ignored. Passing nil removes the dead-letter
+// queue.
+func (q *Queue[T]) SetDeadLetter(dlq *Queue[T]) *Queue[T] {
+
+	deadLetterMu.Lock()
+	defer deadLetterMu.Unlock()
+
+	// Dead-lettering holds the queue lock while taking the dead-letter queue
+	// lock, so a cycle would take the locks in opposite orders and deadlock
+	for next := dlq; next != nil; next = next.dlq {
+		if next == q {
+			return q
+		}
+	}
+
+	q.Lock()
+	defer q.unlock()
+
+	q.dlq = dlq
+	return q
+}
+
+// Attempts returns the number of times the message with the given digest has
+// been leased.
+func (q *Queue[T]) Attempts(digest string) int {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	return q.attempts[digest]
+}
+
+// DeadLetter returns the details of a message which was dead-lettered into
+// this queue.
+// Returns:
+// * DeadLetterInfo: The dead-letter details
+// * bool: true if the message was found or false if not found or it was not
+// dead-lettered
+func (q *Queue[T]) DeadLetter(digest string) (DeadLetterInfo, bool) {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	dead, ok := q.deadLetters[digest]
+
+	return dead.info, ok
+}
+
+// Redrive will move up to n dead-lettered messages from the front of this
+// queue to the back of the queue they were dead-lettered from, with their
+// delivery attempt counts reset. Use NoMax to move all of them. The redrive
+// stops early at a message which was not dead-lettered or which the source
+// queue does not accept because it is full or closed.
+// Returns:
+// * int: The number of messages moved
+func (q *Queue[T]) Redrive(n int) int {
+
+	moved := 0
+
+	for n <= NoMax || moved < n {
+
+		// Find the source of the message at the front. The source lock must be
+		// taken before this queue's lock, in the same order as dead-lettering.
+		q.Lock()
+		digest, _, ok := q.readFB(true)
+		dead, found := q.deadLetters[digest]
+		q.unlock()
+
+		if !ok || !found {
+			break
+		}
+
+		// Both locks are held while the message moves, so it only leaves this
+		// queue once the source has accepted it and can never be lost
+		source := dead.source
+		source.Lock()
+		q.Lock()
+
+		front, message, ok := q.readFB(true)
+		current, found := q.deadLetters[front]
+		retry := !ok || front != digest || !found || current.source != source
+
+		accepted := false
+		if !retry {
+			_ = source.recent.delete(digest)
+			if source.pushFB(false, digest, message).ok() {
+				_, _, _ = q.pullFB(true)
+				accepted = true
+			}
+		}
+
+		// This queue's deferred work runs once the source is unlocked too
+		run := q.settle()
+		q.Unlock()
+		source.unlock()
+		if run != nil {
+			run()
+		}
+
+		if retry {
+			continue
+		}
+		if !accepted {
+			break
+		}
+
+		moved++
+	}
+
+	return moved
+}
+
+// deadLetterMessage will move a message which has reached the max delivery
+// attempts to the dead-letter queue, or drop it if none is set. Returns false
+// if the dead-letter queue did not accept the message, in which case it must
+// be returned to this queue.
+func (q *Queue[T]) deadLetterMessage(digest string, message T, reason error) bool {
+
+	if q.dlq != nil {
+
+		dead := deadLetter[T]{
+			info: DeadLetterInfo{
+				Digest:   digest,
+				Attempts: q.attempts[digest],
+				Reason:   reason,
+			},
+			source: q,
+		}
+
+		// The work deferred by the dead-letter queue, such as its observer
+		// events, must not run until this queue's lock is released too
+		dlq := q.dlq
+		dlq.Lock()
+		_ = dlq.recent.delete(digest)
+		ok := dlq.pushFB(false, digest, message).ok()
+		if ok {
+			dlq.deadLetters[digest] = dead
+		}
+		run := dlq.settle()
+		dlq.Unlock()
+
+		if run != nil {
+			q.later(run)
+		}
+
+		if !ok {
+			return false
+		}
+	}
+
+	q.forget(digest)
+	q.freed()
+	q.emit(EventDeadLettered, digest, message)
+
+	return true
+}
@@ -0,0 +1,189 @@
+package flexqueue_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestFlexQueueDeadLetter(t *testing.T) {
+
+	dlq := flexqueue.NewFlexQueue()
+	queue := flexqueue.NewFlexQueue().SetMaxAttempts(2).SetDeadLetter(dlq)
+
+	queue.PushBack("A", &Message{Digest: "A"})
+	queue.PushBack("B", &Message{Digest: "B"})
+
+	failure := errors.New("failure")
+
+	// the first failed attempt returns the message to the front
+	receipt, _, _, _ := queue.LeaseFront(time.Minute)
+	queue.NackWithReason(receipt, failure)
+	if queue.Attempts("A") != 1 {
+		t.Errorf("expected attempts to be %v but got %v instead", 1, queue.Attempts("A"))
+	}
+
+	// the second failed attempt moves it to the dead-letter queue
+	receipt, digest, _, _ := queue.LeaseFront(time.Minute)
+	if digest != "A" {
+		t.Errorf("expected leased digest to be %v but got %v instead", "A", digest)
+	}
+	queue.NackWithReason(receipt, failure)
+
+	if queue.Has("A") {
+		t.Errorf("expected message %v to not exist in queue", "A")
+	}
+	if queue.Attempts("A") != 0 {
+		t.Errorf("expected attempts to be %v but got %v instead", 0, queue.Attempts("A"))
+	}
+
+	info, ok := dlq.DeadLetter("A")
+	if !ok {
+		t.Fatalf("expected dead letter %v to exist", "A")
+	}
+	if info.Digest != "A" || info.Attempts != 2 || info.Reason != failure {
+		t.Errorf("expected dead letter to be %v/%v/%v but got %v/%v/%v instead", "A", 2, failure, info.Digest, info.Attempts, info.Reason)
+	}
+	if _, message, _ := dlq.ReadFront(); message.(*Message).Digest != "A" {
+		t.Errorf("expected dead letter message to be %v but got %v instead", "A", message)
+	}
+
+	// an acked message is never dead-lettered
+	receipt, _, _, _ = queue.LeaseFront(time.Minute)
+	queue.Ack(receipt)
+	if dlq.Len() != 1 {
+		t.Errorf("expected dead-letter queue len to be %v but got %v instead", 1, dlq.Len())
+	}
+}
+
+func TestFlexQueueDeadLetterTimeout(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	dlq := flexqueue.NewFlexQueue()
+	queue := flexqueue.NewFlexQueueWithClock(clock).SetMaxAttempts(1).SetDeadLetter(dlq)
+
+	queue.PushBack("A", &Message{Digest: "A"})
+	queue.LeaseFront(time.Millisecond * 10)
+
+	clock.Advance(time.Millisecond * 10)
+
+	// the timeout is noticed by the next lease access
+	if _, _, _, ok := queue.LeaseFront(time.Minute); ok {
+		t.Errorf("expected lease of empty queue to be not ok but got ok")
+	}
+
+	info, ok := dlq.DeadLetter("A")
+	if !ok {
+		t.Fatalf("expected dead letter %v to exist", "A")
+	}
+	if !errors.Is(info.Reason, flexqueue.ErrLeaseTimeout) {
+		t.Errorf("expected dead letter reason to be %v but got %v instead", flexqueue.ErrLeaseTimeout, info.Reason)
+	}
+}
+
+func TestFlexQueueDeadLetterDrop(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue().SetMaxAttempts(1)
+
+	queue.PushBack("A", &Message{Digest: "A"})
+	receipt, _, _, _ := queue.LeaseFront(time.Minute)
+	queue.Nack(receipt)
+
+	// without a dead-letter queue the message is dropped
+	if queue.Has("A") {
+		t.Errorf("expected message %v to not exist", "A")
+	}
+}
+
+func TestFlexQueueRedrive(t *testing.T) {
+
+	dlq := flexqueue.NewFlexQueue()
+	queue := flexqueue.NewFlexQueue().SetMaxAttempts(1).SetDeadLetter(dlq).SetMax(2)
+
+	for _, digest := range []string{"A", "B"} {
+		queue.PushBack(digest, &Message{Digest: digest})
+		receipt, _, _, _ := queue.LeaseFront(time.Minute)
+		queue.Nack(receipt)
+	}
+
+	// messages pushed directly to the dead-letter queue have no source
+	dlq.PushBack("C", &Message{Digest: "C"})
+
+	queue.PushBack("D", &Message{Digest: "D"})
+
+	// only one message fits back into the source queue
+	if moved := dlq.Redrive(flexqueue.NoMax); moved != 1 {
+		t.Errorf("expected redrive to move %v but got %v instead", 1, moved)
+	}
+	if !queue.Has("A") || queue.Attempts("A") != 0 {
+		t.Errorf("expected message %v to be redriven with its attempts reset", "A")
+	}
+	if _, ok := dlq.DeadLetter("B"); !ok {
+		t.Errorf("expected dead letter %v to be kept after a failed redrive", "B")
+	}
+
+	queue.Remove("D")
+
+	// the redrive stops at the message without a source
+	if moved := dlq.Redrive(flexqueue.NoMax); moved != 1 {
+		t.Errorf("expected redrive to move %v but got %v instead", 1, moved)
+	}
+	if digest, _, _ := dlq.ReadFront(); digest != "C" {
+		t.Errorf("expected remaining dead letter to be %v but got %v instead", "C", digest)
+	}
+}
+
+func TestFlexQueueRedriveRejected(t *testing.T) {
+
+	dlq := flexqueue.NewFlexQueue()
+	queue := flexqueue.NewFlexQueue().SetMaxAttempts(1).SetDeadLetter(dlq).SetMax(1)
+
+	queue.PushBack("A", &Message{Digest: "A"})
+	receipt, _, _, _ := queue.LeaseFront(time.Minute)
+	queue.Nack(receipt)
+
+	queue.PushBack("B", &Message{Digest: "B"})
+	dlq.Close()
+
+	// a message the source rejects stays in the dead-letter queue, even if it
+	// is closed and could not take the message back
+	if moved := dlq.Redrive(flexqueue.NoMax); moved != 0 {
+		t.Errorf("expected redrive to move %v but got %v instead", 0, moved)
+	}
+	if !dlq.Has("A") || queue.Has("A") {
+		t.Errorf("expected message %v to stay in the dead-letter queue", "A")
+	}
+	if _, ok := dlq.DeadLetter("A"); !ok {
+		t.Errorf("expected dead letter %v to be kept after a failed redrive", "A")
+	}
+}
+
+func TestFlexQueueDeadLetterCycle(t *testing.T) {
+
+	first := flexqueue.NewFlexQueue().SetMaxAttempts(1)
+	second := flexqueue.NewFlexQueue().SetMaxAttempts(1)
+	third := flexqueue.NewFlexQueue().SetMaxAttempts(1)
+
+	// a dead-letter queue which leads back to the queue is ignored
+	first.SetDeadLetter(second)
+	second.SetDeadLetter(third)
+	third.SetDeadLetter(first)
+
+	third.PushBack("A", &Message{Digest: "A"})
+	receipt, _, _, _ := third.LeaseFront(time.Minute)
+	third.Nack(receipt)
+
+	if first.Has("A") || third.Has("A") {
+		t.Errorf("expected message %v to be dropped", "A")
+	}
+
+	first.PushBack("B", &Message{Digest: "B"})
+	receipt, _, _, _ = first.LeaseFront(time.Minute)
+	first.Nack(receipt)
+
+	if !second.Has("B") {
+		t.Errorf("expected message %v to be dead-lettered", "B")
+	}
+}
@@ -0,0 +1,121 @@
+package flexqueue
+
+import "time"
+
+// DedupPolicy decides what happens to the existing message when a message
+// with the same digest is pushed
+type DedupPolicy int
+
+const (
+	// DedupIgnore leaves the existing message untouched. This is the default.
+	DedupIgnore DedupPolicy = iota
+	// DedupReplacePayload replaces the existing message with the pushed
+	// message while keeping its position and ttl.
+	DedupReplacePayload
+	// DedupMoveToTail moves the existing message to the back of the queue
+	// while keeping its payload and ttl.
+	DedupMoveToTail
+	// DedupExtendTTL refreshes the ttl of the existing message with the ttl of
+	// the pushed message, keeping the existing callback. It has no effect if
+	// either message has no ttl.
+	DedupExtendTTL
+)
+
+// SetDedupPolicy sets what happens to the existing message when a duplicate
+// digest is pushed. The policy only applies to messages which are waiting in
+// the queue. Leased and delayed messages, and digests remembered by the dedup
+// window, are always left untouched. Duplicate pushes are still reported as
+// PushDuplicate and as a success by the bool push methods.
+func (q *Queue[T]) SetDedupPolicy(policy DedupPolicy) *Queue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.dedup = policy
+	return q
+}
+
+// PushFrontDedup behaves identical to PushFrontResult except that the given
+// dedup policy is used in place of the queue policy.
+func (q *Queue[T]) PushFrontDedup(digest string, message T, policy DedupPolicy) PushResult {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushAt(opPushFront, "", digest, message, nil, policy)
+}
+
+// PushBackDedup behaves identical to PushBackResult except that the given
+// dedup policy is used in place of the queue policy.
+func (q *Queue[T]) PushBackDedup(digest string, message T, policy DedupPolicy) PushResult {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushAt(opPushBack, "", digest, message, nil, policy)
+}
+
+// PushFrontTTLDedup behaves identical to PushFrontTTLResult except that the
+// given dedup policy is used in place of the queue policy.
+func (q *Queue[T]) PushFrontTTLDedup(digest string, message T, ttl time.Duration, callback ExpiryFunc[T], policy DedupPolicy) PushResult {
+
+	q.Lock()
+	defer q.unlock()
+
+	ctrl, ok := q.liveTTL(digest, message, ttl, callback)
+	if !ok {
+		return PushExpired
+	}
+
+	return q.pushAt(opPushFront, "", digest, message, ctrl, policy)
+}
+
+// PushBackTTLDedup behaves identical to PushBackTTLResult except that the
+// given dedup policy is used in place of the queue policy.
+func (q *Queue[T]) PushBackTTLDedup(digest string, message T, ttl time.Duration, callback ExpiryFunc[T], policy DedupPolicy) PushResult {
+
+	q.Lock()
+	defer q.unlock()
+
+	ctrl, ok := q.liveTTL(digest, message, ttl, callback)
+	if !ok {
+		return PushExpired
+	}
+
+	return q.pushAt(opPushBack, "", digest, message, ctrl, policy)
+}
+
+// dedupe will apply the dedup policy to the existing message for a duplicate
+// push. The ttl control is the ttl of the pushed message, if any. An expired
+// message is left for the next access to remove rather than being changed.
+func (q *Queue[T]) dedupe(policy DedupPolicy, digest string, message T, ctrl *TTLControl[T]) {
+
+	if policy == DedupIgnore || !q.messages.Has(digest) {
+		return
+	}
+
+	if old, ok := q.ttl.get(digest); ok && old.ExpiredAt(q.clock.Now()) {
+		return
+	}
+
+	switch policy {
+	case DedupReplacePayload:
+		_ = q.messages.Update(digest, message)
+		q.logUpdate(digest, message)
+		q.emit(EventUpdated, digest, message)
+	case DedupMoveToTail:
+		_ = q.messages.MoveToBack(digest)
+		q.logMove(opMoveBack, digest, "")
+	case DedupExtendTTL:
+		old, ok := q.ttl.get(digest)
+		if !ok || ctrl == nil {
+			return
+		}
+		old.Expires = ctrl.Expires
+		q.ttl.set(digest, old, old.Expires)
+		q.expiryChanged()
+		q.logResetTTL(digest, old.Expires)
+		existing, _ := q.messages.Read(digest)
+		q.emit(EventTTLReset, digest, existing)
+	}
+}
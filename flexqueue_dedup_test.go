@@ -0,0 +1,162 @@
+package flexqueue_test
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueDedupPolicy(t *testing.T) {
+
+	tests := []struct {
+		name     string
+		policy   flexqueue.DedupPolicy
+		order    string
+		payload  int
+		expires  time.Duration
+		expected flexqueue.PushResult
+	}{
+		{"ignore", flexqueue.DedupIgnore, "ABC", 1, time.Minute, flexqueue.PushDuplicate},
+		{"replace payload", flexqueue.DedupReplacePayload, "ABC", 2, time.Minute, flexqueue.PushDuplicate},
+		{"move to tail", flexqueue.DedupMoveToTail, "BCA", 1, time.Minute, flexqueue.PushDuplicate},
+		{"extend ttl", flexqueue.DedupExtendTTL, "ABC", 1, time.Hour, flexqueue.PushDuplicate},
+	}
+
+	for _, test := range tests {
+
+		clock := flexqueue.NewFakeClock(time.Now())
+		queue := flexqueue.NewQueueWithClock[Message](clock).SetDedupPolicy(test.policy)
+
+		expired := 0
+		cbFunc := func(digest string, message Message) {
+			expired++
+		}
+
+		queue.PushBackTTL("A", Message{Digest: "A", TTL: 1}, time.Minute, cbFunc)
+		queue.PushBack("B", Message{Digest: "B"})
+		queue.PushBack("C", Message{Digest: "C"})
+
+		res := queue.PushFrontTTLResult("A", Message{Digest: "A", TTL: 2}, time.Hour, nil)
+		if res != test.expected {
+			t.Errorf("%v: expected push result to be %v but got %v instead", test.name, test.expected, res)
+		}
+
+		if message, _ := queue.Read("A"); message.TTL != time.Duration(test.payload) {
+			t.Errorf("%v: expected payload to be %v but got %v instead", test.name, test.payload, message.TTL)
+		}
+
+		order := ""
+		queue.Range(func(digest string, message Message) bool {
+			order += digest
+			return true
+		})
+		if order != test.order {
+			t.Errorf("%v: expected order to be %v but got %v instead", test.name, test.order, order)
+		}
+
+		// The existing callback is kept when the ttl is extended
+		clock.Advance(test.expires + time.Second)
+		if queue.Has("A") || expired != 1 {
+			t.Errorf("%v: expected A to expire after %v with the original callback", test.name, test.expires)
+		}
+	}
+}
+
+func TestQueueDedupExpired(t *testing.T) {
+
+	for _, policy := range []flexqueue.DedupPolicy{flexqueue.DedupIgnore, flexqueue.DedupReplacePayload, flexqueue.DedupExtendTTL} {
+
+		clock := flexqueue.NewFakeClock(time.Now())
+		queue := flexqueue.NewQueueWithClock[Message](clock).SetDedupPolicy(policy)
+
+		expired := 0
+		cbFunc := func(digest string, message Message) {
+			expired++
+		}
+
+		queue.PushBackTTL("A", Message{Digest: "A", TTL: 1}, time.Second, cbFunc)
+		clock.Advance(time.Second * 2)
+
+		// An expired message is de-duped like any other until it is accessed,
+		// and the push neither fires its callback nor revives it
+		res := queue.PushBackTTLResult("A", Message{Digest: "A", TTL: 2}, time.Hour, cbFunc)
+		if res != flexqueue.PushDuplicate || expired != 0 {
+			t.Errorf("%v: expected a duplicate without callbacks but got %v and %v callbacks", policy, res, expired)
+		}
+		if queue.Has("A") || expired != 1 {
+			t.Errorf("%v: expected %v to expire on access", policy, "A")
+		}
+	}
+}
+
+func TestQueueDedupPolicyPerPush(t *testing.T) {
+
+	queue := flexqueue.NewQueue[Message]().SetDedupPolicy(flexqueue.DedupMoveToTail)
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("B", Message{Digest: "B"})
+
+	if res := queue.PushBackDedup("A", Message{Digest: "X"}, flexqueue.DedupReplacePayload); res != flexqueue.PushDuplicate {
+		t.Errorf("expected push result to be %v but got %v instead", flexqueue.PushDuplicate, res)
+	}
+	if digest, message, _ := queue.ReadFront(); digest != "A" || message.Digest != "X" {
+		t.Errorf("expected front to be A with payload X but got %v %v instead", digest, message.Digest)
+	}
+
+	// The queue policy applies to blocking pushes too
+	if err := queue.PushFrontWait(context.Background(), "A", Message{Digest: "A"}); err != nil {
+		t.Errorf("expected push error to be nil but got %v instead", err)
+	}
+	if digest, _, _ := queue.ReadBack(); digest != "A" {
+		t.Errorf("expected back to be %v but got %v instead", "A", digest)
+	}
+
+	// Leased messages are left untouched
+	receipt, _, _, _ := queue.LeaseFront(time.Minute)
+	queue.PushBackDedup("B", Message{Digest: "Y"}, flexqueue.DedupReplacePayload)
+	queue.Nack(receipt)
+
+	if _, message, _ := queue.ReadFront(); message.Digest != "B" {
+		t.Errorf("expected leased payload to be %v but got %v instead", "B", message.Digest)
+	}
+}
+
+func TestQueueDedupPolicyWAL(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queue.wal")
+	clock := flexqueue.NewFakeClock(time.Now())
+	opts := flexqueue.WALOptions[Message]{Clock: clock}
+
+	queue, err := flexqueue.OpenQueue(path, opts)
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+
+	cbFunc := func(digest string, message Message) {}
+
+	queue.PushBackTTL("A", Message{Digest: "A"}, time.Second, cbFunc)
+	queue.PushBack("B", Message{Digest: "B"})
+	queue.PushBack("C", Message{Digest: "C"})
+	queue.PushBackDedup("B", Message{Digest: "B", TTL: 5}, flexqueue.DedupReplacePayload)
+	queue.PushBackDedup("C", Message{Digest: "C"}, flexqueue.DedupMoveToTail)
+	queue.PushBackTTLDedup("A", Message{Digest: "A"}, time.Hour, cbFunc, flexqueue.DedupExtendTTL)
+	_ = queue.CloseLog()
+
+	restored, err := flexqueue.OpenQueue(path, opts)
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+
+	clock.Advance(time.Minute)
+
+	if message, _ := restored.Read("B"); message.TTL != 5 {
+		t.Errorf("expected replaced payload to be restored")
+	}
+	if digests := strings.Join(drain(restored), ""); digests != "ABC" {
+		t.Errorf("expected digests to be %v but got %v instead", "ABC", digests)
+	}
+}
@@ -0,0 +1,124 @@
+package flexqueue
+
+import "time"
+
+// PushBackDelayed will add a new message to the queue which stays hidden until
+// the delay has passed, at which point it joins the back of the queue. The
+// message is stored right away so it counts towards de-duplication, Has and
+// the max queue length, but the read, pull and lease methods skip it until it
+// becomes visible. A delay which is not positive pushes the message to the
+// back of the queue immediately.
+// Returns:
+// * bool: true if the message is in the queue and false if it was rejected
+func (q *Queue[T]) PushBackDelayed(digest string, message T, delay time.Duration) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushDelayed(digest, message, q.clock.Now().Add(delay), nil).ok()
+}
+
+// PushAt will add a new message to the queue which stays hidden until the
+// given time. It otherwise behaves the same as PushBackDelayed.
+// Returns:
+// * bool: true if the message is in the queue and false if it was rejected
+func (q *Queue[T]) PushAt(digest string, message T, at time.Time) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushDelayed(digest, message, at, nil).ok()
+}
+
+// PushBackDelayedTTL will add a new delayed message to the queue. It behaves
+// identical to PushBackDelayed except that it attaches a TTL and expiration
+// callback to the message. The TTL starts from the time of the push, not the
+// time the message becomes visible, so a message can expire while delayed.
+// Returns:
+// * bool: true if the message is in the queue and false if it was rejected
+func (q *Queue[T]) PushBackDelayedTTL(digest string, message T, delay time.Duration, ttl time.Duration, callback ExpiryFunc[T]) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushDelayedTTL(digest, message, q.clock.Now().Add(delay), ttl, callback).ok()
+}
+
+// PushAtTTL will add a new scheduled message to the queue. It behaves
+// identical to PushAt except that it attaches a TTL and expiration callback to
+// the message. The TTL starts from the time of the push.
+// Returns:
+// * bool: true if the message is in the queue and false if it was rejected
+func (q *Queue[T]) PushAtTTL(digest string, message T, at time.Time, ttl time.Duration, callback ExpiryFunc[T]) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushDelayedTTL(digest, message, at, ttl, callback).ok()
+}
+
+// Delayed returns the number of messages which are not yet visible. These are
+// not counted by Len.
+func (q *Queue[T]) Delayed() int {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	return q.delayed.len()
+}
+
+// pushDelayedTTL will push a delayed message like pushDelayed with a new ttl
+// control, unless the ttl is already expired
+func (q *Queue[T]) pushDelayedTTL(digest string, message T, at time.Time, ttl time.Duration, callback ExpiryFunc[T]) PushResult {
+
+	ctrl, ok := q.liveTTL(digest, message, ttl, callback)
+	if !ok {
+		return PushExpired
+	}
+
+	return q.pushDelayed(digest, message, at, ctrl)
+}
+
+// pushDelayed will store a message which becomes visible at the given time,
+// following the same rules as push
+func (q *Queue[T]) pushDelayed(digest string, message T, at time.Time, ctrl *TTLControl[T]) PushResult {
+
+	if !at.After(q.clock.Now()) {
+		return q.push(false, digest, message, ctrl)
+	}
+
+	if res := q.admit(digest, message, ctrl, q.dedup); res != PushInserted {
+		return res
+	}
+
+	q.delayed.set(digest, message, at)
+	if ctrl != nil {
+		q.ttl.set(digest, *ctrl, ctrl.Expires)
+	}
+	q.expiryChanged()
+
+	q.logPushDelayed(digest, message, at, ctrl)
+	q.emit(EventPushed, digest, message)
+
+	return PushInserted
+}
+
+// release will move every delayed message which has become visible to the
+// back of the queue, in the order they became visible
+func (q *Queue[T]) release() {
+
+	now := q.clock.Now()
+
+	for {
+		digest, message, at, ok := q.delayed.peek()
+		if !ok || at.After(now) {
+			return
+		}
+
+		_ = q.delayed.delete(digest)
+		_ = q.messages.PushBack(digest, message)
+		q.logRelease(digest)
+
+		q.pullWaiters.signal()
+	}
+}
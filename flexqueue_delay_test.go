@@ -0,0 +1,169 @@
+package flexqueue_test
+
+import (
+	"bytes"
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueDelayed(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock).SetMax(4)
+
+	queue.PushBackDelayed("A", Message{Digest: "A"}, time.Minute)
+	queue.PushAt("B", Message{Digest: "B"}, clock.Now().Add(time.Second))
+	queue.PushBack("C", Message{Digest: "C"})
+	queue.PushBackDelayed("D", Message{Digest: "D"}, 0)
+
+	if !queue.Has("A") {
+		t.Errorf("expected delayed A to be in the queue")
+	}
+	if !queue.PushBack("A", Message{Digest: "X"}) {
+		t.Errorf("expected duplicate push of A to succeed")
+	}
+	if queue.PushBack("E", Message{Digest: "E"}) {
+		t.Errorf("expected push into a queue full of delayed messages to fail")
+	}
+	if queue.Len() != 2 || queue.Delayed() != 2 {
+		t.Errorf("expected len 2 and delayed 2 but got %v and %v instead", queue.Len(), queue.Delayed())
+	}
+
+	if digests := strings.Join(drain(queue), ""); digests != "CD" {
+		t.Errorf("expected digests to be %v but got %v instead", "CD", digests)
+	}
+
+	clock.Advance(time.Second)
+
+	if digest, _, _ := queue.ReadFront(); digest != "B" {
+		t.Errorf("expected read digest to be %v but got %v instead", "B", digest)
+	}
+
+	clock.Advance(time.Minute)
+
+	digest, message, _ := queue.PullBack()
+	if digest != "A" || message.Digest != "A" {
+		t.Errorf("expected pulled digest to be %v but got %v instead", "A", digest)
+	}
+}
+
+func TestQueueDelayedTTL(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock)
+
+	expired := []string{}
+	cbFunc := func(digest string, message Message) {
+		expired = append(expired, message.Digest)
+	}
+
+	queue.PushBackDelayedTTL("A", Message{Digest: "A"}, time.Minute, time.Second, cbFunc)
+	queue.PushAtTTL("B", Message{Digest: "B"}, clock.Now().Add(time.Second), time.Hour, cbFunc)
+	queue.PushBackDelayed("C", Message{Digest: "C"}, time.Hour)
+
+	clock.Advance(time.Second * 2)
+	queue.Prune()
+
+	// A expired before it became visible
+	if strings.Join(expired, "") != "A" {
+		t.Errorf("expected expired to be %v but got %v instead", "A", expired)
+	}
+	if !queue.Remove("C") || queue.Has("C") {
+		t.Errorf("expected delayed C to be removed")
+	}
+	if digests := strings.Join(drain(queue), ""); digests != "B" {
+		t.Errorf("expected digests to be %v but got %v instead", "B", digests)
+	}
+
+	// A ttl which is already expired is rejected and fires the callback
+	if ok := queue.PushBackDelayedTTL("D", Message{Digest: "D"}, time.Minute, -time.Second, cbFunc); ok {
+		t.Errorf("expected push of expired ttl to be not ok but got ok")
+	}
+	if ok := queue.PushAtTTL("E", Message{Digest: "E"}, clock.Now().Add(time.Minute), -time.Second, cbFunc); ok {
+		t.Errorf("expected push of expired ttl to be not ok but got ok")
+	}
+	if strings.Join(expired, "") != "ADE" || queue.Delayed() != 0 {
+		t.Errorf("expected expired to be %v but got %v instead", "ADE", expired)
+	}
+}
+
+func TestQueueDelayedWait(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	queue.StartExpiry(ctx)
+	defer queue.StopExpiry()
+
+	queue.PushBackDelayed("A", Message{Digest: "A"}, time.Minute)
+
+	done := make(chan string)
+	go func() {
+		digest, _, _ := queue.PullFrontWait(ctx)
+		done <- digest
+	}()
+
+	// The janitor releases the message and wakes the blocked puller
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Minute)
+
+	if digest := <-done; digest != "A" {
+		t.Errorf("expected pulled digest to be %v but got %v instead", "A", digest)
+	}
+}
+
+func TestQueueDelayedDurable(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queue.wal")
+	clock := flexqueue.NewFakeClock(time.Now())
+	opts := flexqueue.WALOptions[Message]{Clock: clock}
+
+	queue, err := flexqueue.OpenQueue(path, opts)
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+
+	queue.PushBackDelayed("A", Message{Digest: "A"}, time.Second)
+	queue.PushBackDelayed("B", Message{Digest: "B"}, time.Minute)
+	queue.PushBack("C", Message{Digest: "C"})
+
+	// A is released behind C, then D is pushed behind A
+	clock.Advance(time.Second)
+	queue.ReadFront()
+	queue.PushBack("D", Message{Digest: "D"})
+
+	var buf bytes.Buffer
+	if err := queue.Snapshot(&buf); err != nil {
+		t.Fatalf("expected snapshot error to be nil but got %v instead", err)
+	}
+	_ = queue.CloseLog()
+
+	restored, err := flexqueue.OpenQueue(path, opts)
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+	snapshot, err := flexqueue.RestoreQueue(&buf, flexqueue.SnapshotOptions[Message]{Clock: clock})
+	if err != nil {
+		t.Fatalf("expected restore error to be nil but got %v instead", err)
+	}
+
+	for _, q := range []*flexqueue.Queue[Message]{restored, snapshot} {
+		if q.Delayed() != 1 {
+			t.Errorf("expected delayed to be %v but got %v instead", 1, q.Delayed())
+		}
+		clock.Advance(time.Minute)
+		if digests := strings.Join(drain(q), ""); digests != "CADB" {
+			t.Errorf("expected digests to be %v but got %v instead", "CADB", digests)
+		}
+	}
+}
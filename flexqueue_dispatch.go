@@ -0,0 +1,103 @@
+package flexqueue
+
+// Dispatcher runs the callbacks and event deliveries raised by a single queue
+// method call, in order, once the queue lock has been released. For example a
+// dispatcher of func(fn func()) { go fn() } runs them asynchronously.
+type Dispatcher func(fn func())
+
+// SetDispatcher sets how TTL callbacks, eviction callbacks and observer events
+// are run. By default they run synchronously, after the queue lock has been
+// released but before the queue method which raised them returns. Since the
+// lock is not held callbacks may call back into the queue. Passing nil restores
+// the default.
+func (q *Queue[T]) SetDispatcher(dispatcher Dispatcher) *Queue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.dispatcher = dispatcher
+	return q
+}
+
+// later will queue work to run once the queue lock is released. It must be
+// called with the queue lock held.
+func (q *Queue[T]) later(fn func()) {
+	q.deferred = append(q.deferred, fn)
+}
+
+// expired will queue a ttl callback to run once the queue lock is released
+func (q *Queue[T]) expired(callback ExpiryFunc[T], digest string, message T) {
+	if callback != nil {
+		q.later(func() {
+			callback(digest, message)
+		})
+	}
+}
+
+// unlock will release the queue lock and then run the work which was deferred
+// while it was held, such as ttl callbacks and observer events. All queue
+// state changes are made before the lock is released, so a panicking callback
+// can not leave the queue inconsistent.
+func (q *Queue[T]) unlock() {
+
+	run := q.settle()
+
+	q.Unlock()
+
+	if run != nil {
+		run()
+	}
+}
+
+// settle must be called with the queue lock held just before it is released.
+// It will compact the write-ahead log if it is due and take the work which was
+// deferred while the lock was held, handed to the dispatcher if one is set.
+// Returns nil if there is no deferred work.
+func (q *Queue[T]) settle() func() {
+
+	q.compactIfDue()
+
+	deferred := q.deferred
+	q.deferred = nil
+
+	if len(deferred) == 0 {
+		return nil
+	}
+
+	if dispatcher := q.dispatcher; dispatcher != nil {
+		return func() {
+			dispatcher(func() {
+				runDeferred(deferred)
+			})
+		}
+	}
+
+	return func() {
+		runDeferred(deferred)
+	}
+}
+
+// runDeferred will run every deferred func, even if an earlier one panics.
+// The first panic is raised again once they have all run.
+func runDeferred(deferred []func()) {
+
+	var (
+		panicked bool
+		reason   interface{}
+	)
+
+	for _, fn := range deferred {
+		func() {
+			defer func() {
+				if r := recover(); r != nil && !panicked {
+					panicked, reason = true, r
+				}
+			}()
+			fn()
+		}()
+	}
+
+	if panicked {
+		panic(reason)
+	}
+}
@@ -0,0 +1,106 @@
+package flexqueue_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueCallbackReentrant(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock).SetMax(1).SetOverflowPolicy(flexqueue.OverflowDropFront)
+
+	lens := []int{}
+
+	// Callbacks run outside the lock so they can requeue or inspect the queue
+	var cbFunc flexqueue.ExpiryFunc[Message]
+	cbFunc = func(digest string, message Message) {
+		lens = append(lens, queue.Len())
+		queue.PushBackTTL(digest+"2", message, time.Minute, cbFunc)
+	}
+	queue.SetEvictionCallback(func(digest string, message Message) {
+		lens = append(lens, queue.Len())
+	})
+
+	queue.PushBackTTL("A", Message{Digest: "A"}, time.Second, cbFunc)
+	clock.Advance(time.Second * 2)
+	queue.Prune()
+
+	if !queue.Has("A2") {
+		t.Errorf("expected callback push of %v to succeed", "A2")
+	}
+
+	queue.PushBack("B", Message{Digest: "B"})
+
+	if len(lens) != 2 || lens[0] != 0 || lens[1] != 1 {
+		t.Errorf("expected callback lens to be [0 1] but got %v instead", lens)
+	}
+}
+
+func TestQueueCallbackPanic(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock)
+
+	called := 0
+	cbFunc := func(digest string, message Message) {
+		called++
+		if digest == "A" {
+			panic("callback failed")
+		}
+	}
+
+	queue.PushBackTTL("A", Message{Digest: "A"}, time.Second, cbFunc)
+	queue.PushBackTTL("B", Message{Digest: "B"}, time.Second*2, cbFunc)
+	clock.Advance(time.Second * 3)
+
+	func() {
+		defer func() {
+			if r := recover(); r != "callback failed" {
+				t.Errorf("expected panic to be raised to the caller but got %v instead", r)
+			}
+		}()
+		queue.Prune()
+	}()
+
+	// Every callback ran and the queue is still usable
+	if called != 2 {
+		t.Errorf("expected callback count to be %v but got %v instead", 2, called)
+	}
+	if queue.Len() != 0 {
+		t.Errorf("expected len to be %v but got %v instead", 0, queue.Len())
+	}
+	if !queue.PushBack("A", Message{Digest: "A"}) {
+		t.Errorf("expected push after a panicking callback to succeed")
+	}
+}
+
+func TestQueueDispatcher(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+
+	var wg sync.WaitGroup
+	queue := flexqueue.NewQueueWithClock[Message](clock).SetDispatcher(func(fn func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fn()
+		}()
+	})
+
+	expired := make(chan string, 1)
+	queue.PushBackTTL("A", Message{Digest: "A"}, time.Second, func(digest string, message Message) {
+		expired <- digest
+	})
+
+	clock.Advance(time.Second * 2)
+	queue.Prune()
+	wg.Wait()
+
+	if digest := <-expired; digest != "A" {
+		t.Errorf("expected expired digest to be %v but got %v instead", "A", digest)
+	}
+}
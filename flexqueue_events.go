@@ -0,0 +1,139 @@
+package flexqueue
+
+import "time"
+
+// EventKind identifies the queue state change an Event describes
+type EventKind int
+
+const (
+	// EventPushed means a new message was added to the queue
+	EventPushed EventKind = iota
+	// EventDeduplicated means a push was de-duped against an existing digest
+	EventDeduplicated
+	// EventRejectedFull means a push was rejected because the queue was full
+	EventRejectedFull
+	// EventPulled means a message was pulled from the queue
+	EventPulled
+	// EventRead means a message was read without being removed
+	EventRead
+	// EventUpdated means a message payload was replaced
+	EventUpdated
+	// EventRemoved means a message was removed, or acknowledged after a lease
+	EventRemoved
+	// EventExpired means a message was removed because its ttl expired
+	EventExpired
+	// EventTTLReset means the ttl of a message was reset or extended
+	EventTTLReset
+	// EventEvicted means a message was evicted by the overflow policy
+	EventEvicted
+	// EventDeadLettered means a message reached the max delivery attempts and
+	// was moved to the dead-letter queue, or dropped if none is set
+	EventDeadLettered
+)
+
+// String returns the name of the event kind
+func (k EventKind) String() string {
+	switch k {
+	case EventPushed:
+		return "Pushed"
+	case EventDeduplicated:
+		return "Deduplicated"
+	case EventRejectedFull:
+		return "RejectedFull"
+	case EventPulled:
+		return "Pulled"
+	case EventRead:
+		return "Read"
+	case EventUpdated:
+		return "Updated"
+	case EventRemoved:
+		return "Removed"
+	case EventExpired:
+		return "Expired"
+	case EventTTLReset:
+		return "TTLReset"
+	case EventEvicted:
+		return "Evicted"
+	case EventDeadLettered:
+		return "DeadLettered"
+	default:
+		return "Unknown"
+	}
+}
+
+// Event describes a single queue state change. For de-duped and rejected
+// pushes the message is the one which was pushed.
+type Event[T any] struct {
+	Kind    EventKind // What happened
+	Digest  string    // The message digest
+	Message T         // The message
+	Time    time.Time // When it happened, from the queue clock
+}
+
+// Observer is the signature of a queue event observer
+type Observer[T any] func(event Event[T])
+
+// observer retains the id used to remove a registered observer
+type observer[T any] struct {
+	id int
+	fn Observer[T]
+}
+
+// Observe registers an observer which receives an event for every state change
+// of the queue. Observers are called after the queue lock has been released,
+// so they may safely call back into the queue. The events raised by a single
+// method call are delivered in order, but events from concurrent calls may be
+// delivered in any order. The returned func removes the observer.
+func (q *Queue[T]) Observe(fn Observer[T]) func() {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.observerID++
+	id := q.observerID
+	q.observers = append(q.observers, observer[T]{id: id, fn: fn})
+
+	return func() {
+
+		q.Lock()
+		defer q.unlock()
+
+		for i, o := range q.observers {
+			if o.id == id {
+				// Copy rather than splice so that events already queued with
+				// the old slice are not affected
+				observers := make([]observer[T], 0, len(q.observers)-1)
+				observers = append(observers, q.observers[:i]...)
+				q.observers = append(observers, q.observers[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// emit will queue an event for the registered observers. It must be called
+// with the queue lock held, and the event is delivered by unlock.
+func (q *Queue[T]) emit(kind EventKind, digest string, message T) {
+
+	if q.metrics != nil {
+		q.metrics.record(kind, digest, q.clock.Now())
+	}
+
+	if len(q.observers) == 0 {
+		return
+	}
+
+	event := Event[T]{
+		Kind:    kind,
+		Digest:  digest,
+		Message: message,
+		Time:    q.clock.Now(),
+	}
+	observers := q.observers
+
+	q.later(func() {
+		for _, o := range observers {
+			o.fn(event)
+		}
+	})
+}
@@ -0,0 +1,134 @@
+package flexqueue_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueEvents(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock).SetMax(3).SetOverflowPolicy(flexqueue.OverflowReject)
+
+	events := []string{}
+	stop := queue.Observe(func(event flexqueue.Event[Message]) {
+		if !event.Time.Equal(clock.Now()) {
+			t.Errorf("expected event time to be %v but got %v instead", clock.Now(), event.Time)
+		}
+		events = append(events, event.Kind.String()+":"+event.Digest)
+	})
+
+	cbFunc := func(digest string, message Message) {}
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBackTTL("B", Message{Digest: "B"}, time.Second, cbFunc)
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("C", Message{Digest: "C"})
+	queue.PushBack("D", Message{Digest: "D"})
+	queue.ReadFront()
+	queue.Update("C", Message{Digest: "C"})
+	queue.ResetTTL("B", time.Second)
+	queue.PullFront()
+	queue.Remove("C")
+	clock.Advance(time.Second * 2)
+	queue.Prune()
+
+	stop()
+	queue.PushBack("E", Message{Digest: "E"})
+
+	expected := []string{
+		"Pushed:A",
+		"Pushed:B",
+		"Deduplicated:A",
+		"Pushed:C",
+		"RejectedFull:D",
+		"Read:A",
+		"Updated:C",
+		"TTLReset:B",
+		"Pulled:A",
+		"Removed:C",
+		"Expired:B",
+	}
+	if strings.Join(events, " ") != strings.Join(expected, " ") {
+		t.Errorf("expected events to be %v but got %v instead", expected, events)
+	}
+}
+
+func TestQueueEventsEvicted(t *testing.T) {
+
+	queue := flexqueue.NewQueue[Message]().SetMax(1).SetOverflowPolicy(flexqueue.OverflowDropFront)
+
+	var evicted flexqueue.Event[Message]
+	queue.Observe(func(event flexqueue.Event[Message]) {
+		if event.Kind == flexqueue.EventEvicted {
+			evicted = event
+		}
+	})
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("B", Message{Digest: "B"})
+
+	if evicted.Digest != "A" || evicted.Message.Digest != "A" {
+		t.Errorf("expected evicted message to be %v but got %v instead", "A", evicted.Digest)
+	}
+}
+
+func TestQueueEventsReentrant(t *testing.T) {
+
+	queue := flexqueue.NewQueue[Message]()
+
+	// Observers run outside the lock so they can call back into the queue
+	queue.Observe(func(event flexqueue.Event[Message]) {
+		if event.Kind == flexqueue.EventPulled {
+			queue.PushBack(event.Digest+"2", event.Message)
+		}
+	})
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PullFront()
+
+	if !queue.Has("A2") {
+		t.Errorf("expected observer push of %v to succeed", "A2")
+	}
+}
+
+func TestQueueEventsDeadLettered(t *testing.T) {
+
+	dlq := flexqueue.NewQueue[Message]()
+	queue := flexqueue.NewQueue[Message]().SetMaxAttempts(1).SetDeadLetter(dlq)
+	dropper := flexqueue.NewQueue[Message]().SetMaxAttempts(1)
+
+	dead := []string{}
+	observer := func(event flexqueue.Event[Message]) {
+		if event.Kind == flexqueue.EventDeadLettered {
+			dead = append(dead, event.Digest)
+		}
+	}
+	queue.Observe(observer)
+	dropper.Observe(observer)
+
+	// Dead-letter queue observers run once the source lock is released too, so
+	// they can call back into the source queue
+	lens := []int{}
+	dlq.Observe(func(event flexqueue.Event[Message]) {
+		lens = append(lens, queue.Len())
+	})
+
+	queue.PushBack("A", Message{Digest: "A"})
+	receipt, _, _, _ := queue.LeaseFront(time.Minute)
+	queue.Nack(receipt)
+
+	dropper.PushBack("B", Message{Digest: "B"})
+	receipt, _, _, _ = dropper.LeaseFront(time.Minute)
+	dropper.Nack(receipt)
+
+	if strings.Join(dead, "") != "AB" {
+		t.Errorf("expected dead-lettered to be %v but got %v instead", "AB", dead)
+	}
+	if len(lens) != 1 || lens[0] != 0 {
+		t.Errorf("expected dead-letter observer lens to be %v but got %v instead", []int{0}, lens)
+	}
+}
@@ -0,0 +1,185 @@
+package flexqueue
+
+import (
+	"context"
+	"time"
+)
+
+// janitor is the control block of a running background expiry goroutine
+type janitor struct {
+	stop chan struct{} // Closed by StopExpiry to end the goroutine
+	done chan struct{} // Closed by the goroutine once it has exited
+	wake chan struct{} // Signals that the soonest expiry may have changed
+}
+
+// StartExpiry will start a background goroutine which removes messages and
+// fires their TTL callbacks close to their real expiry time, rather than
+// waiting for the next access or call to Prune. The goroutine sleeps until the
+// soonest expiry in the queue instead of polling. Leased messages whose
+// visibility timeout runs out are returned to the queue on the same schedule.
+// A panic raised by a callback run by the janitor is recovered and dropped. It
+// runs until the context is done or StopExpiry is called. Queues which never
+// call StartExpiry remain goroutine free. Returns true if the janitor was
+// started and false if it was already running.
+func (q *Queue[T]) StartExpiry(ctx context.Context) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	if q.janitor != nil {
+		return false
+	}
+
+	j := &janitor{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+		wake: make(chan struct{}, 1),
+	}
+	q.janitor = j
+
+	go q.runExpiry(ctx, j)
+
+	return true
+}
+
+// StopExpiry will stop the background expiry goroutine started by StartExpiry
+// and wait for it to exit. Returns true if a janitor was stopped and false if
+// none was running.
+func (q *Queue[T]) StopExpiry() bool {
+
+	q.Lock()
+	j := q.janitor
+	q.janitor = nil
+	q.unlock()
+
+	if j == nil {
+		return false
+	}
+
+	close(j.stop)
+	<-j.done
+
+	return true
+}
+
+// runExpiry is the janitor loop. It prunes the queue each time the timer for
+// the soonest expiry fires and re-arms the timer whenever the soonest expiry
+// may have changed.
+func (q *Queue[T]) runExpiry(ctx context.Context, j *janitor) {
+
+	defer func() {
+		q.Lock()
+		if q.janitor == j {
+			q.janitor = nil
+		}
+		q.unlock()
+		close(j.done)
+	}()
+
+	for {
+		var (
+			timer Timer
+			fire  <-chan time.Time
+		)
+
+		if next, ok := q.nextExpiry(); ok {
+			timer = q.clock.NewTimer(next.Sub(q.clock.Now()))
+			fire = timer.C()
+		}
+
+		select {
+		case <-ctx.Done():
+		case <-j.stop:
+		case <-j.wake:
+		case <-fire:
+			q.sweep()
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-j.stop:
+			return
+		default:
+		}
+	}
+}
+
+// sweep will run housekeep for the janitor. A ttl callback or observer which
+// panics is recovered, since there is no caller to raise it to and it would
+// otherwise crash the process, and the janitor keeps running. The queue is
+// still consistent since callbacks only run once every change has been made.
+func (q *Queue[T]) sweep() {
+
+	defer func() {
+		_ = recover()
+	}()
+
+	q.housekeep()
+}
+
+// housekeep will prune expired messages and return messages whose lease
+// visibility timeout has run out.
+func (q *Queue[T]) housekeep() {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.reclaimLeases()
+	_ = q.prune()
+	q.release()
+}
+
+// nextExpiry returns the soonest time at which a ttl expires, a lease
+// visibility timeout runs out or a delayed message becomes visible. Returns
+// false if there are none.
+func (q *Queue[T]) nextExpiry() (time.Time, bool) {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	// A ttl only expires once the clock is past its expires time, so waking
+	// at exactly that time would find nothing to prune
+	_, _, next, ok := q.ttl.peek()
+	if ok {
+		next = next.Add(time.Nanosecond)
+	}
+
+	if visible, found := q.nextVisible(); found && (!ok || visible.Before(next)) {
+		next, ok = visible, true
+	}
+
+	return next, ok
+}
+
+// nextVisible returns the soonest time at which a lease visibility timeout
+// runs out or a delayed message becomes visible, either of which puts a
+// message back in the queue. Returns false if there are none.
+func (q *Queue[T]) nextVisible() (time.Time, bool) {
+
+	_, _, next, ok := q.leases.peek()
+
+	if _, _, at, delayed := q.delayed.peek(); delayed && (!ok || at.Before(next)) {
+		next, ok = at, true
+	}
+
+	return next, ok
+}
+
+// expiryChanged must be called whenever a ttl, lease or delay is added or reset
+// so that a running janitor can re-arm its timer for the soonest expiry.
+func (q *Queue[T]) expiryChanged() {
+
+	if q.janitor == nil {
+		return
+	}
+
+	select {
+	case q.janitor.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,180 @@
+package flexqueue_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestFlexQueueStartExpiry(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+
+	expired := make(chan string, 3)
+	cbFunc := func(digest string, message interface{}) {
+		expired <- digest
+	}
+
+	if ok := queue.StartExpiry(context.Background()); !ok {
+		t.Errorf("expected janitor to start but got not started")
+	}
+	defer queue.StopExpiry()
+
+	if ok := queue.StartExpiry(context.Background()); ok {
+		t.Errorf("expected second janitor to not start but got started")
+	}
+
+	start := time.Now()
+
+	// pushes made after the janitor is running must re-arm its timer
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Millisecond*60, cbFunc)
+	queue.PushBackTTL("B", &Message{Digest: "B"}, time.Millisecond*20, cbFunc)
+	queue.PushBack("C", &Message{Digest: "C"})
+
+	for _, want := range []string{"B", "A"} {
+		select {
+		case digest := <-expired:
+			if digest != want {
+				t.Errorf("expected expired digest to be %v but got %v instead", want, digest)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("expected callback for %v to fire without access", want)
+		}
+	}
+
+	if elapsed := time.Since(start); elapsed < time.Millisecond*60 {
+		t.Errorf("expected callbacks to fire no earlier than the ttl but took %v", elapsed)
+	}
+
+	if queue.Len() != 1 {
+		t.Errorf("expected queue len to be %v but got %v instead", 1, queue.Len())
+	}
+}
+
+func TestFlexQueueStopExpiry(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+
+	cbCount := 0
+	cbFunc := func(digest string, message interface{}) {
+		cbCount++
+	}
+
+	if ok := queue.StopExpiry(); ok {
+		t.Errorf("expected stop without janitor to be not ok but got ok")
+	}
+
+	queue.StartExpiry(context.Background())
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Millisecond*10, cbFunc)
+
+	if ok := queue.StopExpiry(); !ok {
+		t.Errorf("expected stop to be ok but got not ok")
+	}
+
+	time.Sleep(time.Millisecond * 20)
+
+	// the expired message stays until accessed once the janitor is stopped
+	if queue.Len() != 1 {
+		t.Errorf("expected queue len to be %v but got %v instead", 1, queue.Len())
+	}
+	if cbCount != 0 {
+		t.Errorf("expected callback count to be %v but got %v", 0, cbCount)
+	}
+}
+
+func TestFlexQueueExpiryContextCancel(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	queue.StartExpiry(ctx)
+	cancel()
+
+	// the janitor clears itself once the context is done so it can restart
+	deadline := time.Now().Add(time.Second)
+	for !queue.StartExpiry(context.Background()) {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected janitor to restart after context cancel")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	queue.StopExpiry()
+}
+
+func TestFlexQueueExpiryBoundary(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+
+	expired := make(chan string, 1)
+	cbFunc := func(digest string, message interface{}) {
+		expired <- digest
+	}
+
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Second, cbFunc)
+	queue.StartExpiry(context.Background())
+	defer queue.StopExpiry()
+
+	// wait for the janitor to arm its timer for the soonest expiry
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// the message is not expired while the clock sits exactly on its expiry,
+	// so the janitor must keep waiting rather than re-arming straight away
+	clock.Advance(time.Second)
+	time.Sleep(time.Millisecond * 20)
+
+	if n := clock.Timers(); n != 1 {
+		t.Errorf("expected %v armed timer but got %v instead", 1, n)
+	}
+	select {
+	case digest := <-expired:
+		t.Fatalf("expected no callback at the expiry time but got %v", digest)
+	default:
+	}
+
+	clock.Advance(time.Nanosecond)
+
+	select {
+	case <-expired:
+	case <-time.After(time.Second):
+		t.Fatalf("expected callback once the clock is past the expiry")
+	}
+}
+
+func TestFlexQueueExpiryCallbackPanic(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+
+	expired := make(chan string, 1)
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Second, func(digest string, message interface{}) {
+		panic("callback failed")
+	})
+	queue.PushBackTTL("B", &Message{Digest: "B"}, time.Minute, func(digest string, message interface{}) {
+		expired <- digest
+	})
+
+	queue.StartExpiry(context.Background())
+	defer queue.StopExpiry()
+
+	// the panicking callback does not crash the process or stop the janitor
+	for _, advance := range []time.Duration{time.Second * 2, time.Minute} {
+		for clock.Timers() == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		clock.Advance(advance)
+	}
+
+	select {
+	case digest := <-expired:
+		if digest != "B" {
+			t.Errorf("expected expired digest to be %v but got %v instead", "B", digest)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected the janitor to keep running after a callback panic")
+	}
+}
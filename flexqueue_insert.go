@@ -0,0 +1,41 @@
+package flexqueue
+
+// InsertBefore will add a new message to the queue just before the message
+// with the mark digest. It follows the same de-duplication, max length and
+// overflow rules as PushFront. Expired and leased messages can not be used as
+// the mark.
+// Returns:
+// * bool: true if the message was added or if it already existed in the queue
+// based on the digest value (automatic de-duping), and false if the mark was
+// not found or the message was not added because the queue was full
+func (q *Queue[T]) InsertBefore(mark string, digest string, message T) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.insert(opMoveBefore, mark, digest, message)
+}
+
+// InsertAfter will add a new message to the queue just after the message with
+// the mark digest. It otherwise behaves the same as InsertBefore.
+// Returns:
+// * bool: true if the message was added or if it already existed in the queue
+// based on the digest value (automatic de-duping), and false if the mark was
+// not found or the message was not added because the queue was full
+func (q *Queue[T]) InsertAfter(mark string, digest string, message T) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.insert(opMoveAfter, mark, digest, message)
+}
+
+// insert will push a message next to the mark if the mark is in the queue
+func (q *Queue[T]) insert(op byte, mark string, digest string, message T) bool {
+
+	if q.pruneMessage(mark) || !q.messages.Has(mark) {
+		return false
+	}
+
+	return q.pushAt(op, mark, digest, message, nil, q.dedup).ok()
+}
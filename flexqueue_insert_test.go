@@ -0,0 +1,91 @@
+package flexqueue_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueInsert(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock).SetMax(4)
+
+	cbFunc := func(digest string, message Message) {}
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("C", Message{Digest: "C"})
+	queue.PushBackTTL("X", Message{Digest: "X"}, time.Second, cbFunc)
+
+	if !queue.InsertBefore("C", "B", Message{Digest: "B"}) {
+		t.Errorf("expected insert of B to succeed")
+	}
+	// A de-duplicated insert succeeds without moving the existing message
+	if !queue.InsertAfter("B", "C", Message{Digest: "C"}) {
+		t.Errorf("expected insert of duplicate C to succeed")
+	}
+	if queue.InsertAfter("C", "D", Message{Digest: "D"}) {
+		t.Errorf("expected insert of D into a full queue to fail")
+	}
+
+	clock.Advance(time.Second * 2)
+
+	if queue.InsertAfter("X", "D", Message{Digest: "D"}) {
+		t.Errorf("expected insert after expired X to fail")
+	}
+	if !queue.InsertAfter("C", "D", Message{Digest: "D"}) {
+		t.Errorf("expected insert of D to succeed")
+	}
+
+	digests := strings.Join(drain(queue), "")
+	if digests != "ABCD" {
+		t.Errorf("expected digests to be %v but got %v instead", "ABCD", digests)
+	}
+}
+
+func TestQueueInsertEvictsMark(t *testing.T) {
+
+	queue := flexqueue.NewQueue[Message]().SetMax(2).SetOverflowPolicy(flexqueue.OverflowDropFront)
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("B", Message{Digest: "B"})
+
+	// A is evicted to make room so C takes its place at the front
+	if !queue.InsertAfter("A", "C", Message{Digest: "C"}) {
+		t.Errorf("expected insert of C to succeed")
+	}
+
+	digests := strings.Join(drain(queue), "")
+	if digests != "CB" {
+		t.Errorf("expected digests to be %v but got %v instead", "CB", digests)
+	}
+}
+
+func TestQueueInsertWAL(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	queue, err := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("D", Message{Digest: "D"})
+	queue.InsertBefore("D", "C", Message{Digest: "C"})
+	queue.InsertAfter("A", "B", Message{Digest: "B"})
+	_ = queue.CloseLog()
+
+	restored, err := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+
+	digests := strings.Join(drain(restored), "")
+	if digests != "ABCD" {
+		t.Errorf("expected digests to be %v but got %v instead", "ABCD", digests)
+	}
+}
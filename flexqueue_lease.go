@@ -0,0 +1,223 @@
+package flexqueue
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrLeaseTimeout is recorded as the failure reason of a delivery attempt
+// whose lease visibility timeout ran out before it was acked.
+var ErrLeaseTimeout = errors.New("flexqueue: lease visibility timeout ran out")
+
+// lease is a message which has been hidden from readers until it is acked,
+// nacked or its visibility timeout runs out.
+type lease[T any] struct {
+	digest  string
+	message T
+}
+
+// LeaseFront will hide a message at the beginning of the queue from other
+// readers for the visibility duration and return a receipt for it. The
+// message must then be acked to remove it or nacked to put it back. If the
+// visibility timeout runs out first then the message is automatically returned
+// to the front of the queue for redelivery, which provides at-least-once
+// delivery. Messages with an expired ttl are automatically removed.
+// Returns:
+// * string: The lease receipt
+// * string: The message digest
+// * T: The message
+// * bool: true if a message was leased or false if empty queue
+func (q *Queue[T]) LeaseFront(visibility time.Duration) (string, string, T, bool) {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.leaseFB(true, visibility)
+}
+
+// LeaseBack behaves identical to LeaseFront except that the message is
+// leased from the end of the queue.
+// Returns:
+// * string: The lease receipt
+// * string: The message digest
+// * T: The message
+// * bool: true if a message was leased or false if empty queue
+func (q *Queue[T]) LeaseBack(visibility time.Duration) (string, string, T, bool) {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.leaseFB(false, visibility)
+}
+
+// leaseFB will move the first unexpired message from the list into the lease
+// table under a new receipt.
+func (q *Queue[T]) leaseFB(front bool, visibility time.Duration) (string, string, T, bool) {
+
+	digest, message, ok := q.readFB(front)
+	if !ok {
+		return "", "", message, false
+	}
+
+	_ = q.messages.Remove(digest)
+
+	receipt := newReceipt()
+	q.leases.set(receipt, &lease[T]{
+		digest:  digest,
+		message: message,
+	}, q.clock.Now().Add(visibility))
+	q.leased[digest] = receipt
+	q.attempts[digest]++
+	q.expiryChanged()
+
+	return receipt, digest, message, true
+}
+
+// Ack will permanently remove a leased message from the queue.
+// Returns:
+// * bool: true if the lease was found or false if the receipt is unknown or
+// the visibility timeout already ran out
+func (q *Queue[T]) Ack(receipt string) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.reclaimLeases()
+
+	l, ok := q.leases.get(receipt)
+	if !ok {
+		return false
+	}
+
+	_ = q.leases.delete(receipt)
+	delete(q.leased, l.digest)
+	q.forget(l.digest)
+	q.freed()
+	q.emit(EventRemoved, l.digest, l.message)
+
+	return true
+}
+
+// Nack will end a lease early and return the message to the front of the
+// queue so it can be delivered again. If the message has reached the max
+// delivery attempts then it is moved to the dead-letter queue instead.
+// Returns:
+// * bool: true if the lease was found or false if the receipt is unknown or
+// the visibility timeout already ran out
+func (q *Queue[T]) Nack(receipt string) bool {
+	return q.NackWithReason(receipt, nil)
+}
+
+// NackWithReason behaves identical to Nack but also records the reason the
+// delivery attempt failed, which is kept if the message is dead-lettered.
+// Returns:
+// * bool: true if the lease was found or false if the receipt is unknown or
+// the visibility timeout already ran out
+func (q *Queue[T]) NackWithReason(receipt string, reason error) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.reclaimLeases()
+
+	if _, ok := q.leases.get(receipt); !ok {
+		return false
+	}
+
+	q.returnLease(receipt, reason)
+
+	return true
+}
+
+// ExtendLease will reset the visibility timeout of a lease to the new duration
+// based on now, for messages which take longer to process than expected.
+// Returns:
+// * bool: true if the lease was extended or false if the receipt is unknown or
+// the visibility timeout already ran out
+func (q *Queue[T]) ExtendLease(receipt string, visibility time.Duration) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.reclaimLeases()
+
+	l, ok := q.leases.get(receipt)
+	if !ok {
+		return false
+	}
+
+	q.leases.set(receipt, l, q.clock.Now().Add(visibility))
+	q.expiryChanged()
+
+	return true
+}
+
+// Leased returns the number of messages currently hidden by a lease
+func (q *Queue[T]) Leased() int {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	return q.leases.len()
+}
+
+// reclaimLeases will return every message whose visibility timeout has run
+// out to the front of the queue. Only the expired leases are visited.
+func (q *Queue[T]) reclaimLeases() {
+
+	for {
+		receipt, _, expires, ok := q.leases.peek()
+		if !ok || q.clock.Now().Before(expires) {
+			return
+		}
+		q.returnLease(receipt, ErrLeaseTimeout)
+	}
+}
+
+// returnLease will remove the lease and put its message back at the front of
+// the queue, or dead-letter it if it has reached the max delivery attempts.
+// Leased messages already count towards the max queue length so this can not
+// overflow the queue.
+func (q *Queue[T]) returnLease(receipt string, reason error) {
+
+	l, _ := q.leases.get(receipt)
+	_ = q.leases.delete(receipt)
+	delete(q.leased, l.digest)
+
+	if q.maxAttempts > NoMax && q.attempts[l.digest] >= q.maxAttempts {
+		if q.deadLetterMessage(l.digest, l.message, reason) {
+			return
+		}
+	}
+
+	if q.messages.PushFront(l.digest, l.message) {
+		q.logMove(opMoveFront, l.digest, "")
+		q.pullWaiters.signal()
+	}
+}
+
+// dropLease will remove the lease held on the digest, if any, and return the
+// leased message. The message is not returned to the queue.
+func (q *Queue[T]) dropLease(digest string) (T, bool) {
+
+	receipt, ok := q.leased[digest]
+	if !ok {
+		var message T
+		return message, false
+	}
+
+	l, _ := q.leases.get(receipt)
+	_ = q.leases.delete(receipt)
+	delete(q.leased, digest)
+
+	return l.message, true
+}
+
+// newReceipt generates a random lease receipt
+func newReceipt() string {
+	b := make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,225 @@
+package flexqueue_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestFlexQueueLeaseAck(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+	queue.PushBack("A", &Message{Digest: "A"})
+	queue.PushBack("B", &Message{Digest: "B"})
+
+	receipt, digest, message, ok := queue.LeaseFront(time.Minute)
+	if !ok {
+		t.Errorf("expected lease to be ok but got not ok")
+	}
+	if digest != "A" || message.(*Message).Digest != "A" {
+		t.Errorf("expected leased digest to be %v but got %v instead", "A", digest)
+	}
+
+	// the leased message is hidden from other readers
+	if digest, _, _ := queue.ReadFront(); digest != "B" {
+		t.Errorf("expected read digest to be %v but got %v instead", "B", digest)
+	}
+	if _, ok := queue.Read("A"); ok {
+		t.Errorf("expected leased message to not be readable")
+	}
+	if _, second, _, _ := queue.LeaseFront(time.Minute); second != "B" {
+		t.Errorf("expected second lease digest to be %v but got %v instead", "B", second)
+	}
+
+	// but it still exists for de-duplication
+	if !queue.Has("A") {
+		t.Errorf("expected message %v to exist", "A")
+	}
+	queue.PushBack("A", &Message{Digest: "A"})
+	if queue.Len() != 0 || queue.Leased() != 2 {
+		t.Errorf("expected len/leased to be %v/%v but got %v/%v instead", 0, 2, queue.Len(), queue.Leased())
+	}
+
+	if ok := queue.Ack(receipt); !ok {
+		t.Errorf("expected ack to be ok but got not ok")
+	}
+	if ok := queue.Ack(receipt); ok {
+		t.Errorf("expected second ack to be not ok but got ok")
+	}
+	if queue.Has("A") {
+		t.Errorf("expected message %v to not exist", "A")
+	}
+}
+
+func TestFlexQueueLeaseNack(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+	queue.PushBack("A", &Message{Digest: "A"})
+	queue.PushBack("B", &Message{Digest: "B"})
+
+	receipt, _, _, _ := queue.LeaseFront(time.Minute)
+
+	if ok := queue.Nack(receipt); !ok {
+		t.Errorf("expected nack to be ok but got not ok")
+	}
+	if ok := queue.Nack(receipt); ok {
+		t.Errorf("expected second nack to be not ok but got ok")
+	}
+
+	// the message is returned to the front for redelivery
+	if digest, _, _ := queue.PullFront(); digest != "A" {
+		t.Errorf("expected pulled digest to be %v but got %v instead", "A", digest)
+	}
+}
+
+func TestFlexQueueLeaseTimeout(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+	queue.PushBack("A", &Message{Digest: "A"})
+
+	receipt, _, _, _ := queue.LeaseFront(time.Millisecond * 10)
+	if _, _, _, ok := queue.LeaseFront(time.Millisecond * 10); ok {
+		t.Errorf("expected lease of empty queue to be not ok but got ok")
+	}
+
+	clock.Advance(time.Millisecond * 10)
+
+	// the lease ran out so the message is visible again and acks fail
+	if ok := queue.Ack(receipt); ok {
+		t.Errorf("expected ack after timeout to be not ok but got ok")
+	}
+	second, digest, _, ok := queue.LeaseFront(time.Millisecond * 10)
+	if !ok || digest != "A" {
+		t.Errorf("expected redelivery of %v but got %v instead", "A", digest)
+	}
+
+	// extending the lease keeps the message hidden past its first timeout
+	if ok := queue.ExtendLease(second, time.Minute); !ok {
+		t.Errorf("expected extend to be ok but got not ok")
+	}
+
+	clock.Advance(time.Millisecond * 20)
+
+	if _, _, ok := queue.ReadFront(); ok {
+		t.Errorf("expected extended lease to stay hidden")
+	}
+	if ok := queue.Ack(second); !ok {
+		t.Errorf("expected ack to be ok but got not ok")
+	}
+}
+
+func TestFlexQueueLeaseTimeoutJanitor(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+	queue.StartExpiry(context.Background())
+	defer queue.StopExpiry()
+
+	queue.PushBack("A", &Message{Digest: "A"})
+	queue.LeaseFront(time.Millisecond * 10)
+
+	// a blocked consumer is woken when the lease runs out
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	digest, _, err := queue.PullFrontWait(ctx)
+	if err != nil {
+		t.Errorf("expected pull error to be nil but got %v instead", err)
+	}
+	if digest != "A" {
+		t.Errorf("expected pulled digest to be %v but got %v instead", "A", digest)
+	}
+}
+
+func TestFlexQueueLeaseTimeoutOnAccess(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+	queue.PushBack("A", &Message{Digest: "A"})
+	queue.PushBack("B", &Message{Digest: "B"})
+
+	queue.LeaseFront(time.Second)
+	clock.Advance(time.Second)
+
+	// reads and pulls return a lease which ran out without a janitor
+	if digest, _, _ := queue.ReadFront(); digest != "A" {
+		t.Errorf("expected read digest to be %v but got %v instead", "A", digest)
+	}
+	if queue.Leased() != 0 {
+		t.Errorf("expected leased to be %v but got %v instead", 0, queue.Leased())
+	}
+
+	queue.LeaseBack(time.Second)
+	clock.Advance(time.Second)
+
+	if digest, _, _ := queue.PullFront(); digest != "B" {
+		t.Errorf("expected pulled digest to be %v but got %v instead", "B", digest)
+	}
+}
+
+func TestFlexQueueLeaseTimeoutWait(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+	queue.PushBack("A", &Message{Digest: "A"})
+	queue.LeaseFront(time.Second)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	done := make(chan string)
+	go func() {
+		digest, _, _ := queue.PullFrontWait(ctx)
+		done <- digest
+	}()
+
+	// a blocked consumer is woken when the lease runs out without a janitor
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second)
+
+	if digest := <-done; digest != "A" {
+		t.Errorf("expected pulled digest to be %v but got %v instead", "A", digest)
+	}
+}
+
+func TestFlexQueueLeaseTTLAndMax(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock).SetMax(1)
+
+	cbCount := 0
+	cbFunc := func(digest string, message interface{}) {
+		if message.(*Message).Digest != digest {
+			t.Errorf("expected callback message to be %v but got %v instead", digest, message)
+		}
+		cbCount++
+	}
+
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Millisecond*10, cbFunc)
+	receipt, _, _, _ := queue.LeaseFront(time.Minute)
+
+	// leased messages count towards the max
+	if !queue.IsFull() {
+		t.Errorf("expected queue full to be %v but got %v instead", true, queue.IsFull())
+	}
+
+	clock.Advance(time.Millisecond * 20)
+
+	// the ttl keeps running while leased
+	if ok := queue.Prune(); !ok {
+		t.Errorf("expected prune to return %v but got %v", true, ok)
+	}
+	if cbCount != 1 {
+		t.Errorf("expected callback count to be %v but got %v", 1, cbCount)
+	}
+	if ok := queue.Ack(receipt); ok {
+		t.Errorf("expected ack of expired message to be not ok but got ok")
+	}
+	if queue.IsFull() {
+		t.Errorf("expected queue full to be %v but got %v instead", false, queue.IsFull())
+	}
+}
@@ -0,0 +1,211 @@
+package flexqueue
+
+import (
+	"bufio"
+	"expvar"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Stats is a point-in-time snapshot of the queue metrics. The counters and
+// timings are only collected once EnableMetrics has been called, while the
+// depth gauges are always available.
+type Stats struct {
+	Pushes         uint64        // Messages added to the queue
+	DedupHits      uint64        // Pushes de-duped against an existing or recent digest
+	RejectedFull   uint64        // Pushes rejected because the queue was full
+	Pulls          uint64        // Messages pulled from the queue
+	Reads          uint64        // Messages read without being removed
+	Expirations    uint64        // Messages removed because their ttl expired
+	Evictions      uint64        // Messages evicted by the overflow policy
+	Depth          int           // Messages waiting in the queue, as counted by Len
+	Leased         int           // Messages currently leased
+	Delayed        int           // Messages which are not yet visible
+	OldestAge      time.Duration // How long the oldest message has been in the queue
+	ResidenceCount uint64        // Messages which have left the queue
+	ResidenceTotal time.Duration // The total time spent in the queue by messages which have left
+}
+
+// metrics holds the counters and push times of a queue
+type metrics struct {
+	stats  Stats
+	pushed expiryIndex[struct{}]
+}
+
+// EnableMetrics starts collecting the counters and timings reported by Stats.
+// Tracking the time each message was pushed costs O(log n) per push, so it is
+// opt-in. Messages already in the queue are treated as pushed now. Calling it
+// again has no effect.
+func (q *Queue[T]) EnableMetrics() *Queue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	if q.metrics != nil {
+		return q
+	}
+
+	m := &metrics{
+		pushed: newExpiryIndex[struct{}](),
+	}
+	now := q.clock.Now()
+	for digest := range q.messages.indices {
+		m.pushed.set(digest, struct{}{}, now)
+	}
+	for digest := range q.leased {
+		m.pushed.set(digest, struct{}{}, now)
+	}
+	for digest := range q.delayed.entries {
+		m.pushed.set(digest, struct{}{}, now)
+	}
+	q.metrics = m
+
+	return q
+}
+
+// Stats returns a snapshot of the queue metrics.
+func (q *Queue[T]) Stats() Stats {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	var stats Stats
+	if q.metrics != nil {
+		stats = q.metrics.stats
+		if _, _, pushed, ok := q.metrics.pushed.peek(); ok {
+			stats.OldestAge = q.clock.Now().Sub(pushed)
+		}
+	}
+
+	stats.Depth = q.messages.Len()
+	stats.Leased = q.leases.len()
+	stats.Delayed = q.delayed.len()
+
+	return stats
+}
+
+// WritePrometheus will write the queue metrics to w in the Prometheus text
+// exposition format, with every sample labelled with the queue name. To write
+// several queues to the same response use the WritePrometheus func instead,
+// since each metric family may only be described once.
+func (q *Queue[T]) WritePrometheus(w io.Writer, name string) error {
+	return WritePrometheus(w, map[string]*Queue[T]{name: q})
+}
+
+// MetricsHandler returns an http.Handler which serves the queue metrics in the
+// Prometheus text exposition format.
+func (q *Queue[T]) MetricsHandler(name string) http.Handler {
+	return MetricsHandler(map[string]*Queue[T]{name: q})
+}
+
+// WritePrometheus will write the metrics of several queues to w in the
+// Prometheus text exposition format. The queues are keyed by the name used for
+// their queue label. Each metric family is described once and followed by one
+// sample per queue, in name order.
+func WritePrometheus[T any](w io.Writer, queues map[string]*Queue[T]) error {
+
+	names := make([]string, 0, len(queues))
+	for name := range queues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	labels := make([]string, len(names))
+	stats := make([]Stats, len(names))
+	for i, name := range names {
+		labels[i] = fmt.Sprintf("{queue=\"%s\"}", escapeLabel(name))
+		stats[i] = queues[name].Stats()
+	}
+
+	bw := bufio.NewWriter(w)
+
+	metric := func(metric string, kind string, help string, value func(stats Stats) interface{}) {
+		fmt.Fprintf(bw, "# HELP flexqueue_%s %s\n", metric, help)
+		fmt.Fprintf(bw, "# TYPE flexqueue_%s %s\n", metric, kind)
+		for i := range names {
+			fmt.Fprintf(bw, "flexqueue_%s%s %v\n", metric, labels[i], value(stats[i]))
+		}
+	}
+
+	metric("pushes_total", "counter", "Messages added to the queue.", func(s Stats) interface{} { return s.Pushes })
+	metric("dedup_hits_total", "counter", "Pushes de-duped against an existing or recent digest.", func(s Stats) interface{} { return s.DedupHits })
+	metric("rejected_full_total", "counter", "Pushes rejected because the queue was full.", func(s Stats) interface{} { return s.RejectedFull })
+	metric("pulls_total", "counter", "Messages pulled from the queue.", func(s Stats) interface{} { return s.Pulls })
+	metric("reads_total", "counter", "Messages read without being removed.", func(s Stats) interface{} { return s.Reads })
+	metric("expirations_total", "counter", "Messages removed because their ttl expired.", func(s Stats) interface{} { return s.Expirations })
+	metric("evictions_total", "counter", "Messages evicted by the overflow policy.", func(s Stats) interface{} { return s.Evictions })
+	metric("depth", "gauge", "Messages waiting in the queue.", func(s Stats) interface{} { return s.Depth })
+	metric("leased", "gauge", "Messages currently leased.", func(s Stats) interface{} { return s.Leased })
+	metric("delayed", "gauge", "Messages which are not yet visible.", func(s Stats) interface{} { return s.Delayed })
+	metric("oldest_age_seconds", "gauge", "How long the oldest message has been in the queue.", func(s Stats) interface{} { return s.OldestAge.Seconds() })
+
+	fmt.Fprintf(bw, "# HELP flexqueue_residence_seconds Time spent in the queue by messages which have left.\n")
+	fmt.Fprintf(bw, "# TYPE flexqueue_residence_seconds summary\n")
+	for i := range names {
+		fmt.Fprintf(bw, "flexqueue_residence_seconds_sum%s %v\n", labels[i], stats[i].ResidenceTotal.Seconds())
+		fmt.Fprintf(bw, "flexqueue_residence_seconds_count%s %v\n", labels[i], stats[i].ResidenceCount)
+	}
+
+	return bw.Flush()
+}
+
+// MetricsHandler returns an http.Handler which serves the metrics of several
+// queues in the Prometheus text exposition format. See WritePrometheus.
+func MetricsHandler[T any](queues map[string]*Queue[T]) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		_ = WritePrometheus(w, queues)
+	})
+}
+
+// PublishExpvar will publish the queue Stats under the given name with the
+// expvar package, so that they are served from /debug/vars. Like
+// expvar.Publish it panics if the name is already in use.
+func (q *Queue[T]) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return q.Stats()
+	}))
+}
+
+// record will update the counters for a queue event
+func (m *metrics) record(kind EventKind, digest string, now time.Time) {
+	switch kind {
+	case EventPushed:
+		m.stats.Pushes++
+		m.pushed.set(digest, struct{}{}, now)
+	case EventDeduplicated:
+		m.stats.DedupHits++
+	case EventRejectedFull:
+		m.stats.RejectedFull++
+	case EventPulled:
+		m.stats.Pulls++
+	case EventRead:
+		m.stats.Reads++
+	case EventExpired:
+		m.stats.Expirations++
+	case EventEvicted:
+		m.stats.Evictions++
+	}
+}
+
+// left will record the time a message spent in the queue once it has left
+func (m *metrics) left(digest string, now time.Time) {
+
+	pushed, ok := m.pushed.expires(digest)
+	if !ok {
+		return
+	}
+
+	_ = m.pushed.delete(digest)
+	m.stats.ResidenceCount++
+	m.stats.ResidenceTotal += now.Sub(pushed)
+}
+
+// escapeLabel escapes a Prometheus label value
+func escapeLabel(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(value)
+}
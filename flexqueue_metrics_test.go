@@ -0,0 +1,139 @@
+package flexqueue_test
+
+import (
+	"encoding/json"
+	"expvar"
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueStats(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock).SetMax(3)
+
+	// Only the depth gauges are reported before metrics are enabled
+	queue.PushBack("X", Message{Digest: "X"})
+	if stats := queue.Stats(); stats.Pushes != 0 || stats.Depth != 1 {
+		t.Errorf("expected 0 pushes and depth 1 but got %+v instead", stats)
+	}
+
+	queue.EnableMetrics()
+
+	cbFunc := func(digest string, message Message) {}
+
+	queue.PushBack("A", Message{Digest: "A"})
+	clock.Advance(time.Second)
+	queue.PushBackTTL("B", Message{Digest: "B"}, time.Second, cbFunc)
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("C", Message{Digest: "C"})
+	queue.ReadFront()
+	clock.Advance(time.Second * 2)
+	queue.PullFront()
+	queue.Pull("A")
+	queue.Prune()
+	queue.PushBackDelayed("D", Message{Digest: "D"}, time.Minute)
+
+	expected := flexqueue.Stats{
+		Pushes:         3,
+		DedupHits:      1,
+		RejectedFull:   1,
+		Pulls:          2,
+		Reads:          1,
+		Expirations:    1,
+		Depth:          0,
+		Delayed:        1,
+		OldestAge:      0,
+		ResidenceCount: 3,
+		ResidenceTotal: time.Second*3 + time.Second*3 + time.Second*2,
+	}
+	if stats := queue.Stats(); stats != expected {
+		t.Errorf("expected stats to be %+v but got %+v instead", expected, stats)
+	}
+
+	clock.Advance(time.Second * 5)
+	if stats := queue.Stats(); stats.OldestAge != time.Second*5 {
+		t.Errorf("expected oldest age to be %v but got %v instead", time.Second*5, stats.OldestAge)
+	}
+}
+
+func TestQueueMetricsHandler(t *testing.T) {
+
+	queue := flexqueue.NewQueue[Message]().EnableMetrics()
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("B", Message{Digest: "B"})
+	queue.PullFront()
+
+	rec := httptest.NewRecorder()
+	queue.MetricsHandler(`orders "eu"`).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain") {
+		t.Errorf("expected content type to be text/plain but got %v instead", ct)
+	}
+
+	body := rec.Body.String()
+	for _, line := range []string{
+		"# TYPE flexqueue_pushes_total counter",
+		`flexqueue_pushes_total{queue="orders \"eu\""} 2`,
+		`flexqueue_pulls_total{queue="orders \"eu\""} 1`,
+		`flexqueue_depth{queue="orders \"eu\""} 1`,
+		"# TYPE flexqueue_residence_seconds summary",
+		`flexqueue_residence_seconds_count{queue="orders \"eu\""} 1`,
+	} {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("expected metrics to contain %q but got %v instead", line, body)
+		}
+	}
+}
+
+func TestQueueMetricsHandlerMany(t *testing.T) {
+
+	orders := flexqueue.NewQueue[Message]().EnableMetrics()
+	orders.PushBack("A", Message{Digest: "A"})
+	jobs := flexqueue.NewQueue[Message]()
+
+	rec := httptest.NewRecorder()
+	flexqueue.MetricsHandler(map[string]*flexqueue.Queue[Message]{
+		"orders": orders,
+		"jobs":   jobs,
+	}).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+
+	// Each metric family is described once with a sample per queue
+	body := rec.Body.String()
+	if n := strings.Count(body, "# TYPE flexqueue_pushes_total "); n != 1 {
+		t.Errorf("expected %v pushes type line but got %v instead", 1, n)
+	}
+	expected := "# TYPE flexqueue_depth gauge\n" +
+		"flexqueue_depth{queue=\"jobs\"} 0\n" +
+		"flexqueue_depth{queue=\"orders\"} 1\n"
+	if !strings.Contains(body, expected) {
+		t.Errorf("expected metrics to contain %q but got %v instead", expected, body)
+	}
+}
+
+// expvarRuns keeps the expvar names unique when the tests are run repeatedly,
+// since expvar panics if a name is published twice in the same process
+var expvarRuns int64
+
+func TestQueuePublishExpvar(t *testing.T) {
+
+	name := fmt.Sprintf("%s_%d", t.Name(), atomic.AddInt64(&expvarRuns, 1))
+
+	queue := flexqueue.NewQueue[Message]().EnableMetrics()
+	queue.PublishExpvar(name)
+	queue.PushBack("A", Message{Digest: "A"})
+
+	var stats flexqueue.Stats
+	if err := json.Unmarshal([]byte(expvar.Get(name).String()), &stats); err != nil {
+		t.Fatalf("expected expvar to be json but got %v instead", err)
+	}
+	if stats.Pushes != 1 || stats.Depth != 1 {
+		t.Errorf("expected 1 push and depth 1 but got %+v instead", stats)
+	}
+}
@@ -0,0 +1,83 @@
+package flexqueue
+
+// MoveToFront will move a message to the front of the queue while keeping its
+// ttl. Expired and leased messages can not be moved.
+// Returns:
+// * bool: true if the message was moved and false if not found
+func (q *Queue[T]) MoveToFront(digest string) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.move(opMoveFront, digest, "")
+}
+
+// MoveToBack will move a message to the back of the queue while keeping its
+// ttl. Expired and leased messages can not be moved.
+// Returns:
+// * bool: true if the message was moved and false if not found
+func (q *Queue[T]) MoveToBack(digest string) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.move(opMoveBack, digest, "")
+}
+
+// MoveBefore will move a message to just before the message with the mark
+// digest while keeping its ttl. Expired and leased messages can not be moved
+// or used as the mark.
+// Returns:
+// * bool: true if the message was moved and false if either was not found
+func (q *Queue[T]) MoveBefore(digest string, mark string) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.move(opMoveBefore, digest, mark)
+}
+
+// MoveAfter will move a message to just after the message with the mark
+// digest while keeping its ttl. Expired and leased messages can not be moved
+// or used as the mark.
+// Returns:
+// * bool: true if the message was moved and false if either was not found
+func (q *Queue[T]) MoveAfter(digest string, mark string) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.move(opMoveAfter, digest, mark)
+}
+
+// move will apply and log a move operation
+func (q *Queue[T]) move(op byte, digest string, mark string) bool {
+
+	if q.pruneMessage(digest) {
+		return false
+	}
+
+	var ok bool
+
+	switch op {
+	case opMoveFront:
+		ok = q.messages.MoveToFront(digest)
+	case opMoveBack:
+		ok = q.messages.MoveToBack(digest)
+	default:
+		if q.pruneMessage(mark) {
+			return false
+		}
+		if op == opMoveBefore {
+			ok = q.messages.MoveBefore(digest, mark)
+		} else {
+			ok = q.messages.MoveAfter(digest, mark)
+		}
+	}
+
+	if ok {
+		q.logMove(op, digest, mark)
+	}
+
+	return ok
+}
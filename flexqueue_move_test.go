@@ -0,0 +1,82 @@
+package flexqueue_test
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueMove(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock)
+
+	expired := []string{}
+	cbFunc := func(digest string, message Message) {
+		expired = append(expired, digest)
+	}
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBackTTL("B", Message{Digest: "B"}, time.Minute, cbFunc)
+	queue.PushBack("C", Message{Digest: "C"})
+	queue.PushBackTTL("D", Message{Digest: "D"}, time.Second, cbFunc)
+
+	if !queue.MoveToBack("B") {
+		t.Errorf("expected move of B to succeed")
+	}
+	if !queue.MoveBefore("C", "A") {
+		t.Errorf("expected move of C to succeed")
+	}
+
+	clock.Advance(time.Second * 2)
+
+	if queue.MoveToFront("D") {
+		t.Errorf("expected move of expired D to fail")
+	}
+	if queue.MoveAfter("A", "X") {
+		t.Errorf("expected move after a missing mark to fail")
+	}
+
+	// B keeps its ttl after the move
+	clock.Advance(time.Minute)
+
+	digests := strings.Join(drain(queue), "")
+	if digests != "CA" {
+		t.Errorf("expected digests to be %v but got %v instead", "CA", digests)
+	}
+	if strings.Join(expired, "") != "DB" {
+		t.Errorf("expected expired to be %v but got %v instead", "DB", expired)
+	}
+}
+
+func TestQueueMoveWAL(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	queue, err := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+
+	for _, digest := range []string{"A", "B", "C", "D"} {
+		queue.PushBack(digest, Message{Digest: digest})
+	}
+	queue.MoveToFront("D")
+	queue.MoveToBack("A")
+	queue.MoveAfter("B", "C")
+	queue.MoveBefore("A", "B")
+	_ = queue.CloseLog()
+
+	restored, err := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+
+	digests := strings.Join(drain(restored), "")
+	if digests != "DCAB" {
+		t.Errorf("expected digests to be %v but got %v instead", "DCAB", digests)
+	}
+}
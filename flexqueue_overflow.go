@@ -0,0 +1,114 @@
+package flexqueue
+
+// OverflowPolicy decides what happens when a message is pushed into a queue
+// which is already at its max length.
+type OverflowPolicy int
+
+const (
+	// OverflowReject rejects the new message. This is the default.
+	OverflowReject OverflowPolicy = iota
+	// OverflowDropFront evicts the message at the front of the queue to make
+	// room for the new message.
+	OverflowDropFront
+	// OverflowDropBack evicts the message at the back of the queue to make
+	// room for the new message.
+	OverflowDropBack
+	// OverflowPruneThenReject removes messages with an expired ttl and only
+	// rejects the new message if the queue is still full.
+	OverflowPruneThenReject
+)
+
+// EvictFunc is the signature of an overflow eviction callback.
+type EvictFunc[T any] func(digest string, message T)
+
+// SetOverflowPolicy sets what happens when a message is pushed into a queue
+// which is already at its max length.
+func (q *Queue[T]) SetOverflowPolicy(policy OverflowPolicy) *Queue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.overflow = policy
+	return q
+}
+
+// SetTTLAwareCapacity sets whether expired messages count towards the max
+// queue length. When enabled, a push into a full queue first removes the
+// expired messages and fires their callbacks before the overflow policy is
+// applied, so an expired backlog does not cause live pushes to be rejected or
+// live messages to be evicted. IsFull and IsEmpty also leave expired messages
+// out of their counts without removing them. Only the expired part of the ttl
+// index is visited. It is disabled by default.
+func (q *Queue[T]) SetTTLAwareCapacity(enabled bool) *Queue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.ttlAware = enabled
+	return q
+}
+
+// SetEvictionCallback sets a callback which is fired for every message that
+// is evicted by the overflow policy, the same way a TTL callback is fired for
+// every message that expires.
+func (q *Queue[T]) SetEvictionCallback(callback EvictFunc[T]) *Queue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.onEvict = callback
+	return q
+}
+
+// makeRoom will apply the overflow policy to a full queue. Returns true if
+// there is now room for a new message and false if the push must be rejected.
+func (q *Queue[T]) makeRoom() bool {
+
+	// Expired messages are removed before the overflow policy is applied
+	if q.ttlAware && q.prune() && !q.isFull() {
+		return true
+	}
+
+	switch q.overflow {
+	case OverflowDropFront, OverflowDropBack:
+		// Leased messages count towards the max but can not be evicted
+		for q.isFull() {
+			var (
+				digest  string
+				message T
+				ok      bool
+			)
+			if q.overflow == OverflowDropFront {
+				digest, message, ok = q.messages.ReadFront()
+			} else {
+				digest, message, ok = q.messages.ReadBack()
+			}
+			if !ok {
+				return false
+			}
+			q.evictMessage(digest, message)
+		}
+		return true
+	case OverflowPruneThenReject:
+		_ = q.prune()
+		return !q.isFull()
+	default:
+		return false
+	}
+}
+
+// evictMessage will remove the message and its per-message state from the
+// queue and fire the eviction callback. Waiting producers are not signalled
+// since the space is about to be taken by the new message.
+func (q *Queue[T]) evictMessage(digest string, message T) {
+
+	_ = q.messages.Remove(digest)
+	q.forget(digest)
+	q.emit(EventEvicted, digest, message)
+
+	if onEvict := q.onEvict; onEvict != nil {
+		q.later(func() {
+			onEvict(digest, message)
+		})
+	}
+}
@@ -0,0 +1,129 @@
+package flexqueue_test
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestFlexQueueOverflowPolicy(t *testing.T) {
+
+	type tcase struct {
+		Policy   flexqueue.OverflowPolicy
+		TTL      time.Duration
+		Ok       bool
+		Expected []string
+		Evicted  []string
+	}
+
+	fn := func(tc tcase) func(t *testing.T) {
+		return func(t *testing.T) {
+
+			clock := flexqueue.NewFakeClock(time.Now())
+			evicted := []string{}
+			queue := flexqueue.NewFlexQueueWithClock(clock).SetMax(3).SetOverflowPolicy(tc.Policy).SetEvictionCallback(func(digest string, message interface{}) {
+				if message.(*Message).Digest != digest {
+					t.Errorf("expected evicted message to be %v but got %v instead", digest, message)
+				}
+				evicted = append(evicted, digest)
+			})
+
+			queue.PushBack("A", &Message{Digest: "A"})
+			queue.PushBackTTL("B", &Message{Digest: "B"}, tc.TTL, func(digest string, message interface{}) {})
+			queue.PushBack("C", &Message{Digest: "C"})
+
+			clock.Advance(time.Millisecond * 10)
+
+			if ok := queue.PushBack("D", &Message{Digest: "D"}); ok != tc.Ok {
+				t.Errorf("expected push to return %v but got %v instead", tc.Ok, ok)
+			}
+
+			// de-dupes never evict
+			queue.PushBack("D", &Message{Digest: "D"})
+
+			digests := []string{}
+			for {
+				digest, _, ok := queue.PullFront()
+				if !ok {
+					break
+				}
+				digests = append(digests, digest)
+			}
+
+			if fmt.Sprint(digests) != fmt.Sprint(tc.Expected) {
+				t.Errorf("expected queue to contain %v but got %v instead", tc.Expected, digests)
+			}
+			if fmt.Sprint(evicted) != fmt.Sprint(tc.Evicted) {
+				t.Errorf("expected evicted messages to be %v but got %v instead", tc.Evicted, evicted)
+			}
+		}
+	}
+
+	tcases := map[string]tcase{
+		"reject": {
+			Policy:   flexqueue.OverflowReject,
+			TTL:      time.Millisecond,
+			Ok:       false,
+			Expected: []string{"A", "C"},
+			Evicted:  []string{},
+		},
+		"drop front": {
+			Policy:   flexqueue.OverflowDropFront,
+			TTL:      time.Minute,
+			Ok:       true,
+			Expected: []string{"B", "C", "D"},
+			Evicted:  []string{"A"},
+		},
+		"drop back": {
+			Policy:   flexqueue.OverflowDropBack,
+			TTL:      time.Minute,
+			Ok:       true,
+			Expected: []string{"A", "B", "D"},
+			Evicted:  []string{"C"},
+		},
+		"prune then reject expired": {
+			Policy:   flexqueue.OverflowPruneThenReject,
+			TTL:      time.Millisecond,
+			Ok:       true,
+			Expected: []string{"A", "C", "D"},
+			Evicted:  []string{},
+		},
+		"prune then reject unexpired": {
+			Policy:   flexqueue.OverflowPruneThenReject,
+			TTL:      time.Minute,
+			Ok:       false,
+			Expected: []string{"A", "B", "C"},
+			Evicted:  []string{},
+		},
+	}
+
+	for k, v := range tcases {
+		t.Run(k, fn(v))
+	}
+}
+
+func TestFlexQueueOverflowEvictsTTL(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock).SetMax(1).SetOverflowPolicy(flexqueue.OverflowDropFront)
+
+	cbCount := 0
+	cbFunc := func(digest string, message interface{}) {
+		cbCount++
+	}
+
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Millisecond*10, cbFunc)
+	queue.PushBack("B", &Message{Digest: "B"})
+
+	clock.Advance(time.Millisecond * 20)
+
+	// the evicted message must not expire afterwards
+	if ok := queue.Prune(); ok {
+		t.Errorf("expected prune to return %v but got %v", false, ok)
+	}
+	if cbCount != 0 {
+		t.Errorf("expected callback count to be %v but got %v", 0, cbCount)
+	}
+}
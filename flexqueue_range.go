@@ -0,0 +1,37 @@
+package flexqueue
+
+// Range will call fn for each message from the front to the back of the queue
+// and stops early if fn returns false. Expired messages are skipped but not
+// removed, and leased or delayed messages are not visited. The queue is read
+// locked for the duration so fn must not call any other method of the queue.
+func (q *Queue[T]) Range(fn func(digest string, message T) bool) {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	q.messages.Range(q.live(fn))
+}
+
+// RangeReverse will call fn for each message from the back to the front of
+// the queue and stops early if fn returns false. It otherwise behaves the same
+// as Range.
+func (q *Queue[T]) RangeReverse(fn func(digest string, message T) bool) {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	q.messages.RangeReverse(q.live(fn))
+}
+
+// live wraps fn so that it is not called for expired messages
+func (q *Queue[T]) live(fn func(digest string, message T) bool) func(string, T) bool {
+
+	now := q.clock.Now()
+
+	return func(digest string, message T) bool {
+		if ctrl, ok := q.ttl.get(digest); ok && ctrl.ExpiredAt(now) {
+			return true
+		}
+		return fn(digest, message)
+	}
+}
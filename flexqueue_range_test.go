@@ -0,0 +1,49 @@
+package flexqueue_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueRange(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock)
+
+	cbFunc := func(digest string, message Message) {
+		t.Errorf("expected no callback for %v during range", digest)
+	}
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBackTTL("B", Message{Digest: "B"}, time.Second, cbFunc)
+	queue.PushBack("C", Message{Digest: "C"})
+	queue.PushBack("D", Message{Digest: "D"})
+	queue.LeaseBack(time.Minute)
+
+	clock.Advance(time.Minute)
+
+	forward := ""
+	queue.Range(func(digest string, message Message) bool {
+		forward += message.Digest
+		return true
+	})
+	if forward != "AC" {
+		t.Errorf("expected forward range to be %v but got %v instead", "AC", forward)
+	}
+
+	reverse := ""
+	queue.RangeReverse(func(digest string, message Message) bool {
+		reverse += digest
+		return false
+	})
+	if reverse != "C" {
+		t.Errorf("expected reverse range to be %v but got %v instead", "C", reverse)
+	}
+
+	// the expired message is still counted since range does not prune
+	if queue.Len() != 3 {
+		t.Errorf("expected len to be %v but got %v instead", 3, queue.Len())
+	}
+}
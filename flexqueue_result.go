@@ -0,0 +1,124 @@
+package flexqueue
+
+import (
+	"errors"
+	"time"
+)
+
+var (
+	// ErrQueueFull is returned when a message is not pushed because the queue
+	// is at its max length.
+	ErrQueueFull = errors.New("flexqueue: queue is full")
+	// ErrDuplicate is returned when a message is not pushed because a message
+	// with the same digest already exists in the queue.
+	ErrDuplicate = errors.New("flexqueue: duplicate digest")
+	// ErrRecentDuplicate is returned when a message is not pushed because a
+	// message with the same digest left the queue within the dedup window.
+	ErrRecentDuplicate = errors.New("flexqueue: digest seen within dedup window")
+)
+
+// PushResult is the outcome of a push operation
+type PushResult int
+
+const (
+	// PushInserted means the message was added to the queue
+	PushInserted PushResult = iota
+	// PushDuplicate means a message with the same digest was already in the
+	// queue so the push was de-duped
+	PushDuplicate
+	// PushFull means the message was not added because the queue was full
+	PushFull
+	// PushExpired means the message was not added because its ttl was already
+	// expired
+	PushExpired
+	// PushClosed means the message was not added because the queue is closed
+	PushClosed
+	// PushRecent means a message with the same digest left the queue within
+	// the dedup window so the push was de-duped
+	PushRecent
+)
+
+// String returns the name of the push result
+func (r PushResult) String() string {
+	switch r {
+	case PushInserted:
+		return "Inserted"
+	case PushDuplicate:
+		return "Duplicate"
+	case PushFull:
+		return "Full"
+	case PushExpired:
+		return "Expired"
+	case PushClosed:
+		return "Closed"
+	case PushRecent:
+		return "Recent"
+	default:
+		return "Unknown"
+	}
+}
+
+// Err returns the sentinel error matching the push result, or nil if the
+// message was inserted.
+func (r PushResult) Err() error {
+	switch r {
+	case PushInserted:
+		return nil
+	case PushDuplicate:
+		return ErrDuplicate
+	case PushFull:
+		return ErrQueueFull
+	case PushExpired:
+		return ErrExpired
+	case PushRecent:
+		return ErrRecentDuplicate
+	default:
+		return ErrClosed
+	}
+}
+
+// ok returns true for the results which the bool push methods report as a
+// success, which are inserts and de-dupes.
+func (r PushResult) ok() bool {
+	return r == PushInserted || r == PushDuplicate || r == PushRecent
+}
+
+// PushFrontResult behaves identical to PushFront except that it reports
+// whether the message was inserted, de-duped or rejected.
+func (q *Queue[T]) PushFrontResult(digest string, message T) PushResult {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushFB(true, digest, message)
+}
+
+// PushBackResult behaves identical to PushBack except that it reports
+// whether the message was inserted, de-duped or rejected.
+func (q *Queue[T]) PushBackResult(digest string, message T) PushResult {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushFB(false, digest, message)
+}
+
+// PushFrontTTLResult behaves identical to PushFrontTTL except that it reports
+// whether the message was inserted, de-duped, rejected or already expired.
+func (q *Queue[T]) PushFrontTTLResult(digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) PushResult {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushFBTTL(true, digest, message, ttl, callback)
+}
+
+// PushBackTTLResult behaves identical to PushBackTTL except that it reports
+// whether the message was inserted, de-duped, rejected or already expired.
+func (q *Queue[T]) PushBackTTLResult(digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) PushResult {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushFBTTL(false, digest, message, ttl, callback)
+}
@@ -0,0 +1,120 @@
+package flexqueue_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestFlexQueuePushResult(t *testing.T) {
+
+	type tcase struct {
+		Push     func(queue *flexqueue.FlexQueue, digest string, ttl time.Duration) flexqueue.PushResult
+		TTL      time.Duration
+		Expected []flexqueue.PushResult
+	}
+
+	cbFunc := func(digest string, message interface{}) {}
+
+	fn := func(tc tcase) func(t *testing.T) {
+		return func(t *testing.T) {
+
+			queue := flexqueue.NewFlexQueue().SetMax(1)
+
+			results := []flexqueue.PushResult{
+				tc.Push(queue, "A", tc.TTL),
+				tc.Push(queue, "A", tc.TTL),
+				tc.Push(queue, "B", tc.TTL),
+				tc.Push(queue, "C", -time.Second),
+			}
+			queue.Close()
+			queue.Remove("A")
+			results = append(results, tc.Push(queue, "D", tc.TTL))
+
+			for i := range tc.Expected {
+				if results[i] != tc.Expected[i] {
+					t.Errorf("expected push %v result to be %v but got %v instead", i, tc.Expected[i], results[i])
+				}
+			}
+		}
+	}
+
+	tcases := map[string]tcase{
+		"push front": {
+			Push: func(queue *flexqueue.FlexQueue, digest string, ttl time.Duration) flexqueue.PushResult {
+				return queue.PushFrontResult(digest, &Message{Digest: digest})
+			},
+			Expected: []flexqueue.PushResult{flexqueue.PushInserted, flexqueue.PushDuplicate, flexqueue.PushFull, flexqueue.PushFull, flexqueue.PushClosed},
+		},
+		"push back": {
+			Push: func(queue *flexqueue.FlexQueue, digest string, ttl time.Duration) flexqueue.PushResult {
+				return queue.PushBackResult(digest, &Message{Digest: digest})
+			},
+			Expected: []flexqueue.PushResult{flexqueue.PushInserted, flexqueue.PushDuplicate, flexqueue.PushFull, flexqueue.PushFull, flexqueue.PushClosed},
+		},
+		"push front ttl": {
+			Push: func(queue *flexqueue.FlexQueue, digest string, ttl time.Duration) flexqueue.PushResult {
+				return queue.PushFrontTTLResult(digest, &Message{Digest: digest}, ttl, cbFunc)
+			},
+			TTL:      time.Minute,
+			Expected: []flexqueue.PushResult{flexqueue.PushInserted, flexqueue.PushDuplicate, flexqueue.PushFull, flexqueue.PushExpired, flexqueue.PushClosed},
+		},
+		"push back ttl": {
+			Push: func(queue *flexqueue.FlexQueue, digest string, ttl time.Duration) flexqueue.PushResult {
+				return queue.PushBackTTLResult(digest, &Message{Digest: digest}, ttl, cbFunc)
+			},
+			TTL:      time.Minute,
+			Expected: []flexqueue.PushResult{flexqueue.PushInserted, flexqueue.PushDuplicate, flexqueue.PushFull, flexqueue.PushExpired, flexqueue.PushClosed},
+		},
+	}
+
+	for k, v := range tcases {
+		t.Run(k, fn(v))
+	}
+}
+
+func TestFlexQueuePushResultErr(t *testing.T) {
+
+	tcases := map[flexqueue.PushResult]error{
+		flexqueue.PushInserted:  nil,
+		flexqueue.PushDuplicate: flexqueue.ErrDuplicate,
+		flexqueue.PushFull:      flexqueue.ErrQueueFull,
+		flexqueue.PushExpired:   flexqueue.ErrExpired,
+		flexqueue.PushClosed:    flexqueue.ErrClosed,
+	}
+
+	for res, err := range tcases {
+		if !errors.Is(res.Err(), err) {
+			t.Errorf("expected %v error to be %v but got %v instead", res, err, res.Err())
+		}
+	}
+}
+
+func TestFlexQueuePushTTLDuplicate(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+
+	cbCount := 0
+	cbFunc := func(digest string, message interface{}) {
+		cbCount++
+	}
+
+	queue.PushBack("A", &Message{Digest: "A"})
+
+	// a de-duped ttl push must not attach a ttl to the existing message
+	if res := queue.PushBackTTLResult("A", &Message{Digest: "A"}, time.Millisecond, cbFunc); res != flexqueue.PushDuplicate {
+		t.Errorf("expected push result to be %v but got %v instead", flexqueue.PushDuplicate, res)
+	}
+
+	clock.Advance(time.Millisecond * 5)
+
+	if !queue.Has("A") {
+		t.Errorf("expected message %v to exist", "A")
+	}
+	if cbCount != 0 {
+		t.Errorf("expected callback count to be %v but got %v", 0, cbCount)
+	}
+}
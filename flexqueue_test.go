@@ -1195,3 +1195,112 @@ func TestFlexQueueMaxLenEmptyFull(t *testing.T) {
 		t.Errorf("expected queue full to be %v but got %v instead", true, queue.IsFull())
 	}
 }
+
+func TestQueueGeneric(t *testing.T) {
+
+	queue := flexqueue.NewQueue[Message]().SetMax(2)
+
+	expired := []string{}
+	cbFunc := func(digest string, message Message) {
+		expired = append(expired, digest)
+	}
+
+	if ok := queue.PushBack("A", Message{Digest: "A"}); !ok {
+		t.Errorf("expected push to be ok but got not ok")
+	}
+	if ok := queue.PushBackTTL("B", Message{Digest: "B"}, time.Millisecond*10, cbFunc); !ok {
+		t.Errorf("expected push to be ok but got not ok")
+	}
+	if ok := queue.PushBack("C", Message{Digest: "C"}); ok {
+		t.Errorf("expected push to full queue to be not ok but got ok")
+	}
+
+	time.Sleep(time.Millisecond * 20)
+
+	// messages are returned as their concrete type without assertion
+	digest, message, ok := queue.PullBack()
+	if !ok {
+		t.Errorf("expected pull to be ok but got not ok")
+	}
+	if digest != "A" || message.Digest != "A" {
+		t.Errorf("expected extracted message to be %v but got %v instead", "A", message.Digest)
+	}
+
+	// the expiration callback receives the concrete type
+	if len(expired) != 1 || expired[0] != "B" {
+		t.Errorf("expected expired messages to be %v but got %v instead", []string{"B"}, expired)
+	}
+
+	if _, message, ok = queue.PullFront(); ok || message.Digest != "" {
+		t.Errorf("expected pull from empty queue to return the zero value but got %v", message)
+	}
+}
+
+func TestFlexQueuePruneExpiryOrder(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+
+	expired := []string{}
+	cbFunc := func(digest string, message interface{}) {
+		expired = append(expired, digest)
+	}
+
+	// push in an order which differs from the expiry order
+	ttls := map[string]time.Duration{
+		"A": time.Millisecond * 30,
+		"B": time.Millisecond * 10,
+		"C": time.Hour,
+		"D": time.Millisecond * 20,
+		"E": time.Millisecond * 5,
+	}
+	for _, digest := range []string{"A", "B", "C", "D", "E"} {
+		queue.PushBackTTL(digest, &Message{Digest: digest}, ttls[digest], cbFunc)
+	}
+
+	// resetting a ttl must reorder it
+	queue.ResetTTL("A", time.Millisecond)
+
+	clock.Advance(time.Millisecond * 40)
+
+	if ok := queue.Prune(); !ok {
+		t.Errorf("expected prune to return %v but got %v", true, ok)
+	}
+
+	want := []string{"A", "E", "B", "D"}
+	if fmt.Sprint(expired) != fmt.Sprint(want) {
+		t.Errorf("expected callbacks in order %v but got %v instead", want, expired)
+	}
+	if queue.Len() != 1 {
+		t.Errorf("expected queue len to be %v but got %v instead", 1, queue.Len())
+	}
+}
+
+func TestFlexQueuePullClearsTTL(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock)
+
+	cbCount := 0
+	cbFunc := func(digest string, message interface{}) {
+		cbCount++
+	}
+
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Millisecond*10, cbFunc)
+	queue.PushBackTTL("B", &Message{Digest: "B"}, time.Millisecond*10, cbFunc)
+	queue.PushBackTTL("C", &Message{Digest: "C"}, time.Millisecond*10, cbFunc)
+
+	queue.PullFront()
+	queue.Pull("B")
+	queue.Remove("C")
+
+	clock.Advance(time.Millisecond * 20)
+
+	// messages which left the queue must not expire afterwards
+	if ok := queue.Prune(); ok {
+		t.Errorf("expected prune to return %v but got %v", false, ok)
+	}
+	if cbCount != 0 {
+		t.Errorf("expected callback count to be %v but got %v", 0, cbCount)
+	}
+}
@@ -0,0 +1,296 @@
+package flexqueue
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrClosed is returned by the blocking queue methods once the queue has
+	// been closed and no further messages can be delivered.
+	ErrClosed = errors.New("flexqueue: queue is closed")
+	// ErrExpired is returned when a message is pushed with a ttl which is
+	// already expired at the time of insertion.
+	ErrExpired = errors.New("flexqueue: message ttl is already expired")
+)
+
+// waitList is a FIFO list of goroutines blocked on a queue condition. Each
+// waiter owns a buffered channel which receives a single wake up signal. All
+// methods must be called while holding the queue lock.
+type waitList struct {
+	waiters *list.List
+}
+
+// newWaitList creates an empty wait list
+func newWaitList() waitList {
+	return waitList{
+		waiters: list.New(),
+	}
+}
+
+// add will register a new waiter. Waiters which were already woken once but
+// lost the race for the message are added to the front so they are served
+// before newer waiters.
+func (w *waitList) add(front bool) *list.Element {
+	if front {
+		return w.waiters.PushFront(make(chan struct{}, 1))
+	}
+	return w.waiters.PushBack(make(chan struct{}, 1))
+}
+
+// signal will wake the longest waiting goroutine. Returns true if a waiter
+// was woken and false if there were no waiters.
+func (w *waitList) signal() bool {
+	if e := w.waiters.Front(); e != nil {
+		w.waiters.Remove(e)
+		e.Value.(chan struct{}) <- struct{}{}
+		return true
+	}
+	return false
+}
+
+// broadcast will wake all waiting goroutines
+func (w *waitList) broadcast() {
+	for w.signal() {
+	}
+}
+
+// cancel will remove a waiter which is giving up. If the waiter was already
+// signalled then the signal is passed on to the next waiter so it is not lost.
+func (w *waitList) cancel(e *list.Element) {
+	select {
+	case <-e.Value.(chan struct{}):
+		w.signal()
+	default:
+		w.waiters.Remove(e)
+	}
+}
+
+// wait will block on the waiter until it is signalled, the timer fires or the
+// context is done. The timer may be nil. It must be called without holding the
+// queue lock and returns with the queue lock held.
+// Returns:
+// * bool: true if the timer fired
+// * error: nil if woken, or the context error
+func (q *Queue[T]) wait(ctx context.Context, w *waitList, e *list.Element, timer Timer) (bool, error) {
+
+	var fire <-chan time.Time
+	if timer != nil {
+		fire = timer.C()
+		defer timer.Stop()
+	}
+
+	select {
+	case <-e.Value.(chan struct{}):
+		q.Lock()
+		return false, nil
+	case <-fire:
+		q.Lock()
+		w.cancel(e)
+		return true, nil
+	case <-ctx.Done():
+		q.Lock()
+		w.cancel(e)
+		return false, ctx.Err()
+	}
+}
+
+// PullFrontWait will remove a message from the beginning of the queue and
+// return a reference to it, blocking until a message is available, the context
+// is done or the queue is closed. Messages with an expired ttl are
+// automatically removed. Waiting callers are served in the order they arrived.
+// Returns:
+// * string: The message digest
+// * T: The message
+// * error: nil on success, the context error, or ErrClosed
+func (q *Queue[T]) PullFrontWait(ctx context.Context) (string, T, error) {
+	return q.pullFBWait(ctx, true)
+}
+
+// PullBackWait will remove a message from the end of the queue and return a
+// reference to it, blocking until a message is available, the context is done
+// or the queue is closed. Messages with an expired ttl are automatically
+// removed. Waiting callers are served in the order they arrived.
+// Returns:
+// * string: The message digest
+// * T: The message
+// * error: nil on success, the context error, or ErrClosed
+func (q *Queue[T]) PullBackWait(ctx context.Context) (string, T, error) {
+	return q.pullFBWait(ctx, false)
+}
+
+// pullFBWait will loop on pullFB until it returns a message, parking on the
+// pull wait list whenever the queue is empty. A parked caller also wakes when
+// the next lease runs out or delayed message becomes visible.
+func (q *Queue[T]) pullFBWait(ctx context.Context, front bool) (string, T, error) {
+
+	q.Lock()
+	defer q.unlock()
+
+	woken := false
+
+	for {
+		if digest, message, ok := q.pullFB(front); ok {
+			return digest, message, nil
+		}
+
+		if q.closed {
+			var message T
+			return "", message, ErrClosed
+		}
+
+		if err := ctx.Err(); err != nil {
+			var message T
+			return "", message, err
+		}
+
+		// Wake up in time to take a message whose lease runs out or which
+		// stops being delayed, since nothing else may signal it
+		var timer Timer
+		if next, ok := q.nextVisible(); ok {
+			timer = q.clock.NewTimer(next.Sub(q.clock.Now()))
+		}
+
+		e := q.pullWaiters.add(woken)
+		q.unlock()
+		if _, err := q.wait(ctx, &q.pullWaiters, e, timer); err != nil {
+			var message T
+			return "", message, err
+		}
+		woken = true
+	}
+}
+
+// PushFrontWait will add a new message to the front of the queue, blocking
+// while the queue is full until space frees up through a pull, remove or ttl
+// expiration, the context is done or the queue is closed. If the digest
+// already exists in the queue then it returns nil right away without updating
+// the message. Waiting callers are served in the order they arrived.
+// Returns:
+// * error: nil on success or de-dupe, the context error, or ErrClosed
+func (q *Queue[T]) PushFrontWait(ctx context.Context, digest string, message T) error {
+	return q.pushFBWait(ctx, true, digest, message, nil)
+}
+
+// PushBackWait will add a new message to the end of the queue, blocking
+// while the queue is full until space frees up through a pull, remove or ttl
+// expiration, the context is done or the queue is closed. If the digest
+// already exists in the queue then it returns nil right away without updating
+// the message. Waiting callers are served in the order they arrived.
+// Returns:
+// * error: nil on success or de-dupe, the context error, or ErrClosed
+func (q *Queue[T]) PushBackWait(ctx context.Context, digest string, message T) error {
+	return q.pushFBWait(ctx, false, digest, message, nil)
+}
+
+// PushFrontTTLWait behaves identical to PushFrontWait except that it attaches
+// a TTL and expiration callback to the message. The ttl is measured from the
+// moment the message is actually inserted.
+// Returns:
+// * error: nil on success or de-dupe, the context error, ErrClosed or ErrExpired
+func (q *Queue[T]) PushFrontTTLWait(ctx context.Context, digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) error {
+	return q.pushFBWait(ctx, true, digest, message, &pushTTL[T]{ttl, callback})
+}
+
+// PushBackTTLWait behaves identical to PushBackWait except that it attaches
+// a TTL and expiration callback to the message. The ttl is measured from the
+// moment the message is actually inserted.
+// Returns:
+// * error: nil on success or de-dupe, the context error, ErrClosed or ErrExpired
+func (q *Queue[T]) PushBackTTLWait(ctx context.Context, digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) error {
+	return q.pushFBWait(ctx, false, digest, message, &pushTTL[T]{ttl, callback})
+}
+
+// pushTTL holds the optional ttl arguments of a blocking push
+type pushTTL[T any] struct {
+	ttl      time.Duration
+	callback ExpiryFunc[T]
+}
+
+// pushFBWait will loop until the message can be pushed, parking on the push
+// wait list whenever the queue is full. A parked caller also wakes to prune the
+// next message whose ttl runs out.
+func (q *Queue[T]) pushFBWait(ctx context.Context, front bool, digest string, message T, ttl *pushTTL[T]) error {
+
+	q.Lock()
+	defer q.unlock()
+
+	// Reject a ttl which is already expired before the overflow policy can
+	// evict anything to make room for it
+	if ttl != nil {
+		if _, ok := q.liveTTL(digest, message, ttl.ttl, ttl.callback); !ok {
+			return ErrExpired
+		}
+	}
+
+	woken := false
+
+	for {
+		// De-dupes go through right away, even if the queue is full, so that
+		// the dedup policy is applied
+		dupe := q.contains(digest) || q.isRecent(digest)
+
+		if q.closed && !dupe {
+			return ErrClosed
+		}
+
+		if dupe || !q.isFull() || q.makeRoom() {
+			// The ttl is measured from the moment the message is inserted
+			var ctrl *TTLControl[T]
+			if ttl != nil {
+				ctrl = q.newTTL(ttl.ttl, ttl.callback)
+			}
+			if res := q.push(front, digest, message, ctrl); !res.ok() {
+				return res.Err()
+			}
+			return nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		// Wake up in time to prune the next message whose ttl runs out, since
+		// nothing else may remove it
+		var timer Timer
+		if _, _, expires, ok := q.ttl.peek(); ok {
+			timer = q.clock.NewTimer(expires.Add(time.Nanosecond).Sub(q.clock.Now()))
+		}
+
+		e := q.pushWaiters.add(woken)
+		q.unlock()
+		fired, err := q.wait(ctx, &q.pushWaiters, e, timer)
+		if err != nil {
+			return err
+		}
+		if fired {
+			_ = q.prune()
+		}
+		woken = true
+	}
+}
+
+// Close will mark the queue as closed and wake all blocked callers. Messages
+// already in the queue can still be read and pulled, but no new messages will
+// be accepted. Blocking pushes and blocking pulls on an empty queue will return
+// ErrClosed.
+func (q *Queue[T]) Close() {
+
+	q.Lock()
+	defer q.unlock()
+
+	q.closed = true
+	q.pullWaiters.broadcast()
+	q.pushWaiters.broadcast()
+}
+
+// IsClosed returns true if the queue has been closed and false if its not
+func (q *Queue[T]) IsClosed() bool {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	return q.closed
+}
@@ -0,0 +1,332 @@
+package flexqueue_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestFlexQueuePullWait(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+
+	type result struct {
+		digest string
+		err    error
+	}
+	results := make(chan result)
+
+	// start the consumer on an empty queue
+	go func() {
+		digest, _, err := queue.PullFrontWait(context.Background())
+		results <- result{digest, err}
+	}()
+
+	select {
+	case r := <-results:
+		t.Fatalf("expected pull to block but got %v", r)
+	case <-time.After(time.Millisecond * 10):
+	}
+
+	if ok := queue.PushBack("A", &Message{Digest: "A"}); !ok {
+		t.Errorf("expected push to be ok but got not ok")
+	}
+
+	select {
+	case r := <-results:
+		if r.err != nil {
+			t.Errorf("expected pull error to be nil but got %v instead", r.err)
+		}
+		if r.digest != "A" {
+			t.Errorf("expected extracted digest to be %v but got %v instead", "A", r.digest)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected pull to be woken by push")
+	}
+
+	if queue.Len() != 0 {
+		t.Errorf("expected queue len to be %v but got %v instead", 0, queue.Len())
+	}
+}
+
+func TestFlexQueuePullWaitSkipsExpired(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+
+	cbCount := 0
+	cbFunc := func(digest string, message interface{}) {
+		cbCount++
+	}
+
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Millisecond*5, cbFunc)
+	queue.PushBack("B", &Message{Digest: "B"})
+
+	time.Sleep(time.Millisecond * 10)
+
+	digest, _, err := queue.PullFrontWait(context.Background())
+	if err != nil {
+		t.Errorf("expected pull error to be nil but got %v instead", err)
+	}
+	if digest != "B" {
+		t.Errorf("expected extracted digest to be %v but got %v instead", "B", digest)
+	}
+	if cbCount != 1 {
+		t.Errorf("expected callback count to be %v but got %v", 1, cbCount)
+	}
+}
+
+func TestFlexQueuePullWaitCancel(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	if _, _, err := queue.PullBackWait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected pull error to be %v but got %v instead", context.DeadlineExceeded, err)
+	}
+
+	// a cancelled waiter must not swallow the next message
+	if ok := queue.PushBack("A", &Message{Digest: "A"}); !ok {
+		t.Errorf("expected push to be ok but got not ok")
+	}
+	if !queue.Has("A") {
+		t.Errorf("expected message %v to exist", "A")
+	}
+}
+
+func TestFlexQueuePullWaitClose(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+	queue.PushBack("A", &Message{Digest: "A"})
+
+	errs := make(chan error)
+	go func() {
+		// the first pull drains the queue and the second blocks until close
+		for i := 0; i < 2; i++ {
+			_, _, err := queue.PullFrontWait(context.Background())
+			errs <- err
+		}
+	}()
+
+	if err := <-errs; err != nil {
+		t.Errorf("expected pull error to be nil but got %v instead", err)
+	}
+
+	time.Sleep(time.Millisecond * 10)
+	queue.Close()
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, flexqueue.ErrClosed) {
+			t.Errorf("expected pull error to be %v but got %v instead", flexqueue.ErrClosed, err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("expected pull to be woken by close")
+	}
+
+	if !queue.IsClosed() {
+		t.Errorf("expected queue closed to be %v but got %v instead", true, queue.IsClosed())
+	}
+	if ok := queue.PushBack("B", &Message{Digest: "B"}); ok {
+		t.Errorf("expected push to closed queue to be not ok but got ok")
+	}
+}
+
+func TestFlexQueuePullWaitFairness(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+
+	order := make(chan int)
+	for i := 0; i < 3; i++ {
+		go func(i int) {
+			_, _, _ = queue.PullFrontWait(context.Background())
+			order <- i
+		}(i)
+		// give each consumer time to park before starting the next
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	// each push wakes the longest waiting consumer
+	for i := 0; i < 3; i++ {
+		queue.PushBack(fmt.Sprint(i), i)
+		if got := <-order; got != i {
+			t.Errorf("expected consumer %v to be served but got %v instead", i, got)
+		}
+	}
+}
+
+func TestFlexQueuePushWait(t *testing.T) {
+
+	type tcase struct {
+		Free func(queue *flexqueue.FlexQueue)
+	}
+
+	fn := func(tc tcase) func(t *testing.T) {
+		return func(t *testing.T) {
+
+			queue := flexqueue.NewFlexQueue().SetMax(1)
+
+			if err := queue.PushBackTTLWait(context.Background(), "A", &Message{Digest: "A"}, time.Millisecond*20, func(digest string, message interface{}) {}); err != nil {
+				t.Errorf("expected push error to be nil but got %v instead", err)
+			}
+
+			// a de-dupe returns right away even though the queue is full
+			if err := queue.PushFrontWait(context.Background(), "A", &Message{Digest: "A"}); err != nil {
+				t.Errorf("expected push error to be nil but got %v instead", err)
+			}
+
+			errs := make(chan error)
+			go func() {
+				errs <- queue.PushBackWait(context.Background(), "B", &Message{Digest: "B"})
+			}()
+
+			select {
+			case err := <-errs:
+				t.Fatalf("expected push to block but got %v", err)
+			case <-time.After(time.Millisecond * 5):
+			}
+
+			tc.Free(queue)
+
+			select {
+			case err := <-errs:
+				if err != nil {
+					t.Errorf("expected push error to be nil but got %v instead", err)
+				}
+			case <-time.After(time.Second):
+				t.Fatalf("expected push to be woken by freed space")
+			}
+
+			if !queue.Has("B") {
+				t.Errorf("expected message %v to exist", "B")
+			}
+		}
+	}
+
+	tcases := map[string]tcase{
+		"pull": {
+			Free: func(queue *flexqueue.FlexQueue) { queue.PullFront() },
+		},
+		"remove": {
+			Free: func(queue *flexqueue.FlexQueue) { queue.Remove("A") },
+		},
+		"prune": {
+			Free: func(queue *flexqueue.FlexQueue) {
+				time.Sleep(time.Millisecond * 30)
+				queue.Prune()
+			},
+		},
+	}
+
+	for k, v := range tcases {
+		t.Run(k, fn(v))
+	}
+}
+
+func TestFlexQueuePushWaitCancel(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue().SetMax(1)
+	queue.PushBack("A", &Message{Digest: "A"})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+
+	if err := queue.PushFrontWait(ctx, "B", &Message{Digest: "B"}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected push error to be %v but got %v instead", context.DeadlineExceeded, err)
+	}
+	if queue.Has("B") {
+		t.Errorf("expected message %v to not exist", "B")
+	}
+
+	errs := make(chan error)
+	go func() {
+		errs <- queue.PushBackWait(context.Background(), "C", &Message{Digest: "C"})
+	}()
+
+	time.Sleep(time.Millisecond * 10)
+	queue.Close()
+
+	if err := <-errs; !errors.Is(err, flexqueue.ErrClosed) {
+		t.Errorf("expected push error to be %v but got %v instead", flexqueue.ErrClosed, err)
+	}
+}
+
+func TestFlexQueuePushWaitExpired(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+
+	cbCount := 0
+	cbFunc := func(digest string, message interface{}) {
+		cbCount++
+	}
+
+	if err := queue.PushFrontTTLWait(context.Background(), "A", &Message{Digest: "A"}, -time.Second, cbFunc); !errors.Is(err, flexqueue.ErrExpired) {
+		t.Errorf("expected push error to be %v but got %v instead", flexqueue.ErrExpired, err)
+	}
+	if cbCount != 1 {
+		t.Errorf("expected callback count to be %v but got %v", 1, cbCount)
+	}
+	if queue.Len() != 0 {
+		t.Errorf("expected queue len to be %v but got %v instead", 0, queue.Len())
+	}
+}
+
+func TestFlexQueuePushWaitExpiredNoEvict(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue().SetMax(1).SetOverflowPolicy(flexqueue.OverflowDropFront)
+
+	evicted := 0
+	queue.SetEvictionCallback(func(digest string, message interface{}) {
+		evicted++
+	})
+
+	queue.PushBack("A", &Message{Digest: "A"})
+
+	// an expired ttl is rejected before anything is evicted to make room
+	if err := queue.PushBackTTLWait(context.Background(), "B", &Message{Digest: "B"}, -time.Second, nil); !errors.Is(err, flexqueue.ErrExpired) {
+		t.Errorf("expected push error to be %v but got %v instead", flexqueue.ErrExpired, err)
+	}
+	if evicted != 0 || !queue.Has("A") {
+		t.Errorf("expected %v to be kept but got %v evictions", "A", evicted)
+	}
+}
+
+func TestFlexQueuePushWaitTTLExpiry(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewFlexQueueWithClock(clock).SetMax(1)
+
+	expired := make(chan string, 1)
+	queue.PushBackTTL("A", &Message{Digest: "A"}, time.Second, func(digest string, message interface{}) {
+		expired <- digest
+	})
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	done := make(chan error)
+	go func() {
+		done <- queue.PushBackWait(ctx, "B", &Message{Digest: "B"})
+	}()
+
+	// a blocked producer is woken when the ttl runs out without a janitor
+	for clock.Timers() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	clock.Advance(time.Second * 2)
+
+	if err := <-done; err != nil {
+		t.Errorf("expected push error to be nil but got %v instead", err)
+	}
+	if digest := <-expired; digest != "A" {
+		t.Errorf("expected expired digest to be %v but got %v instead", "A", digest)
+	}
+	if !queue.Has("B") {
+		t.Errorf("expected message %v to exist", "B")
+	}
+}
@@ -0,0 +1,85 @@
+package flexqueue
+
+import "time"
+
+// DefaultDedupWindowSize is the default max number of digests remembered by
+// the dedup window
+const DefaultDedupWindowSize = 100000
+
+// SetDedupWindow sets how long a digest is remembered after its message leaves
+// the queue, whether it was pulled, removed, expired, evicted or dead-lettered.
+// Pushing a remembered digest is de-duped and reported as PushRecent by the
+// result push methods. Use 0 to disable the window and forget every digest,
+// which is the default. Remembered digests are not written to the log or
+// snapshots.
+func (q *Queue[T]) SetDedupWindow(window time.Duration) *Queue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	if window > 0 {
+		q.window = window
+	} else {
+		q.window = 0
+		q.recent = newExpiryIndex[struct{}]()
+	}
+	return q
+}
+
+// SetDedupWindowSize sets the max number of digests remembered by the dedup
+// window to bound its memory. Once the limit is reached the digest closest to
+// being forgotten is dropped early. The default is DefaultDedupWindowSize.
+func (q *Queue[T]) SetDedupWindowSize(size int) *Queue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	if size > 0 {
+		q.windowSize = size
+	} else {
+		q.windowSize = DefaultDedupWindowSize
+	}
+	q.trimRecent()
+	return q
+}
+
+// isRecent returns true if the digest left the queue within the dedup window
+func (q *Queue[T]) isRecent(digest string) bool {
+
+	if q.window == 0 {
+		return false
+	}
+
+	now := q.clock.Now()
+	for {
+		key, _, forget, ok := q.recent.peek()
+		if !ok || forget.After(now) {
+			break
+		}
+		_ = q.recent.delete(key)
+	}
+
+	_, ok := q.recent.get(digest)
+
+	return ok
+}
+
+// remember will add the digest to the dedup window, if one is set
+func (q *Queue[T]) remember(digest string) {
+
+	if q.window == 0 {
+		return
+	}
+
+	q.recent.set(digest, struct{}{}, q.clock.Now().Add(q.window))
+	q.trimRecent()
+}
+
+// trimRecent will drop the digests closest to being forgotten until the dedup
+// window is within its max size
+func (q *Queue[T]) trimRecent() {
+	for q.recent.len() > q.windowSize {
+		key, _, _, _ := q.recent.peek()
+		_ = q.recent.delete(key)
+	}
+}
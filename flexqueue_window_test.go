@@ -0,0 +1,120 @@
+package flexqueue_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueDedupWindow(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock).SetDedupWindow(time.Minute)
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("B", Message{Digest: "B"})
+	queue.PullFront()
+	queue.Remove("B")
+
+	tests := []struct {
+		advance  time.Duration
+		digest   string
+		expected flexqueue.PushResult
+	}{
+		{0, "A", flexqueue.PushRecent},
+		{time.Second * 30, "B", flexqueue.PushRecent},
+		{time.Second * 30, "A", flexqueue.PushInserted},
+		{0, "A", flexqueue.PushDuplicate},
+		{0, "C", flexqueue.PushInserted},
+	}
+
+	for _, test := range tests {
+		clock.Advance(test.advance)
+		res := queue.PushBackResult(test.digest, Message{Digest: test.digest})
+		if res != test.expected {
+			t.Errorf("expected push result of %v to be %v but got %v instead", test.digest, test.expected, res)
+		}
+	}
+
+	if res := flexqueue.PushRecent; !errors.Is(res.Err(), flexqueue.ErrRecentDuplicate) {
+		t.Errorf("expected error to be %v but got %v instead", flexqueue.ErrRecentDuplicate, res.Err())
+	}
+
+	// The bool push methods report a windowed de-dupe as a success
+	queue.PullFront()
+	if !queue.PushBack("A", Message{Digest: "A"}) || queue.Has("A") {
+		t.Errorf("expected push of A to be de-duped by the window")
+	}
+
+	// Disabling the window forgets every digest
+	queue.SetDedupWindow(0)
+	if res := queue.PushBackResult("A", Message{Digest: "A"}); res != flexqueue.PushInserted {
+		t.Errorf("expected push result to be %v but got %v instead", flexqueue.PushInserted, res)
+	}
+}
+
+func TestQueueDedupWindowExpired(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock).SetDedupWindow(time.Minute)
+
+	cbFunc := func(digest string, message Message) {}
+
+	queue.PushBackTTL("A", Message{Digest: "A"}, time.Second, cbFunc)
+	clock.Advance(time.Second * 2)
+	queue.Prune()
+
+	if res := queue.PushBackResult("A", Message{Digest: "A"}); res != flexqueue.PushRecent {
+		t.Errorf("expected push result to be %v but got %v instead", flexqueue.PushRecent, res)
+	}
+}
+
+func TestQueueDedupWindowSize(t *testing.T) {
+
+	queue := flexqueue.NewQueue[Message]().SetDedupWindow(time.Hour).SetDedupWindowSize(2)
+
+	for _, digest := range []string{"A", "B", "C"} {
+		queue.PushBack(digest, Message{Digest: digest})
+		queue.PullFront()
+	}
+
+	// A was the oldest digest so it was dropped to stay within the size
+	tests := []struct {
+		digest   string
+		expected flexqueue.PushResult
+	}{
+		{"A", flexqueue.PushInserted},
+		{"B", flexqueue.PushRecent},
+		{"C", flexqueue.PushRecent},
+	}
+
+	for _, test := range tests {
+		res := queue.PushBackResult(test.digest, Message{Digest: test.digest})
+		if res != test.expected {
+			t.Errorf("expected push result of %v to be %v but got %v instead", test.digest, test.expected, res)
+		}
+	}
+}
+
+func TestQueueDedupWindowRedrive(t *testing.T) {
+
+	dlq := flexqueue.NewQueue[Message]()
+	queue := flexqueue.NewQueue[Message]().SetDedupWindow(time.Hour).SetMaxAttempts(1).SetDeadLetter(dlq)
+
+	queue.PushBack("A", Message{Digest: "A"})
+	receipt, _, _, _ := queue.LeaseFront(time.Minute)
+	queue.Nack(receipt)
+
+	// Producers are de-duped but a redrive still returns the message
+	if res := queue.PushBackResult("A", Message{Digest: "A"}); res != flexqueue.PushRecent {
+		t.Errorf("expected push result to be %v but got %v instead", flexqueue.PushRecent, res)
+	}
+	if moved := dlq.Redrive(flexqueue.NoMax); moved != 1 {
+		t.Errorf("expected moved to be %v but got %v instead", 1, moved)
+	}
+	if !queue.Has("A") {
+		t.Errorf("expected A to be redriven")
+	}
+}
@@ -0,0 +1,30 @@
+//go:build go1.23
+
+package flexqueue
+
+import "iter"
+
+// All returns an iterator over the items from the front to the back of the
+// list. The list must not be modified during the iteration.
+func (l *List[K, V]) All() iter.Seq2[K, V] {
+	return l.Range
+}
+
+// Backward returns an iterator over the items from the back to the front of
+// the list. The list must not be modified during the iteration.
+func (l *List[K, V]) Backward() iter.Seq2[K, V] {
+	return l.RangeReverse
+}
+
+// All returns an iterator over the unexpired messages from the front to the
+// back of the queue. The queue is read locked for the duration of the
+// iteration so the loop body must not call any other method of the queue.
+func (q *Queue[T]) All() iter.Seq2[string, T] {
+	return q.Range
+}
+
+// Backward returns an iterator over the unexpired messages from the back to
+// the front of the queue. It otherwise behaves the same as All.
+func (q *Queue[T]) Backward() iter.Seq2[string, T] {
+	return q.RangeReverse
+}
@@ -0,0 +1,39 @@
+//go:build go1.23
+
+package flexqueue_test
+
+import (
+	"testing"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestIterators(t *testing.T) {
+
+	list := flexqueue.NewFlexList()
+	list.PushBack("A", 1)
+	list.PushBack("B", 2)
+
+	queue := flexqueue.NewFlexQueue()
+	queue.PushBack("C", 3)
+	queue.PushBack("D", 4)
+
+	visited := ""
+	for index := range list.All() {
+		visited += index
+	}
+	for index := range list.Backward() {
+		visited += index
+	}
+	for digest := range queue.All() {
+		visited += digest
+	}
+	for digest := range queue.Backward() {
+		visited += digest
+		break
+	}
+
+	if visited != "ABBACDD" {
+		t.Errorf("expected visited to be %v but got %v instead", "ABBACDD", visited)
+	}
+}
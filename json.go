@@ -0,0 +1,316 @@
+package flexqueue
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// JSONFormat decides how a List is represented in json
+type JSONFormat int
+
+const (
+	// JSONObject represents the list as a json object with its keys in list
+	// order. Keys which do not marshal to a json string, such as numbers, are
+	// quoted the same way encoding/json quotes map keys. This is the default.
+	JSONObject JSONFormat = iota
+	// JSONPairs represents the list as a json array of {"index", "item"}
+	// objects in list order.
+	JSONPairs
+)
+
+// ItemDecoder decodes the raw json of a single list item. It is used by
+// UnmarshalJSON when set, which allows a FlexList to decode items into their
+// concrete types rather than the generic json types.
+type ItemDecoder[K comparable, V any] func(index K, raw json.RawMessage) (V, error)
+
+// jsonPair is a single list item in the JSONPairs format
+type jsonPair struct {
+	Index json.RawMessage `json:"index"`
+	Item  json.RawMessage `json:"item"`
+}
+
+// SetJSONFormat sets how the list is represented by MarshalJSON
+func (l *List[K, V]) SetJSONFormat(format JSONFormat) *List[K, V] {
+	l.format = format
+	return l
+}
+
+// SetItemDecoder sets a hook which UnmarshalJSON uses to decode each item
+func (l *List[K, V]) SetItemDecoder(decoder ItemDecoder[K, V]) *List[K, V] {
+	l.decoder = decoder
+	return l
+}
+
+// MarshalJSON encodes the list in order using the format set by SetJSONFormat
+func (l *List[K, V]) MarshalJSON() ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	if l.format == JSONPairs {
+		buf.WriteByte('[')
+	} else {
+		buf.WriteByte('{')
+	}
+
+	for e := l.items.Front(); e != nil; e = e.Next() {
+		wrapper := e.Value.(*itemWrapper[K, V])
+
+		if e != l.items.Front() {
+			buf.WriteByte(',')
+		}
+
+		item, err := json.Marshal(wrapper.item)
+		if err != nil {
+			return nil, err
+		}
+
+		if l.format == JSONPairs {
+			index, err := json.Marshal(wrapper.index)
+			if err != nil {
+				return nil, err
+			}
+			pair, err := json.Marshal(jsonPair{
+				Index: index,
+				Item:  item,
+			})
+			if err != nil {
+				return nil, err
+			}
+			buf.Write(pair)
+			continue
+		}
+
+		key, err := marshalKey(wrapper.index)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(item)
+	}
+
+	if l.format == JSONPairs {
+		buf.WriteByte(']')
+	} else {
+		buf.WriteByte('}')
+	}
+
+	return buf.Bytes(), nil
+}
+
+// UnmarshalJSON decodes either json format into the list in order. Like
+// decoding into a map, existing items with the same index are updated in place
+// and new items are added to the back of the list.
+func (l *List[K, V]) UnmarshalJSON(data []byte) error {
+
+	if l.items == nil {
+		*l = *NewList[K, V]()
+	}
+
+	data = bytes.TrimSpace(data)
+
+	switch {
+	case bytes.Equal(data, []byte("null")):
+		return nil
+	case len(data) > 0 && data[0] == '[':
+		return l.unmarshalPairs(data)
+	default:
+		return l.unmarshalObject(data)
+	}
+}
+
+// unmarshalPairs decodes the JSONPairs format
+func (l *List[K, V]) unmarshalPairs(data []byte) error {
+
+	var pairs []jsonPair
+	if err := json.Unmarshal(data, &pairs); err != nil {
+		return err
+	}
+
+	for _, pair := range pairs {
+		var index K
+		if err := json.Unmarshal(pair.Index, &index); err != nil {
+			return err
+		}
+		if err := l.set(index, pair.Item); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// unmarshalObject decodes the JSONObject format. The object is read token by
+// token since decoding into a map would lose the key order.
+func (l *List[K, V]) unmarshalObject(data []byte) error {
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("flexqueue: cannot unmarshal %v into List", tok)
+	}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+
+		index, err := unmarshalKey[K](tok.(string))
+		if err != nil {
+			return err
+		}
+
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return err
+		}
+
+		if err := l.set(index, raw); err != nil {
+			return err
+		}
+	}
+
+	_, err := dec.Token()
+
+	return err
+}
+
+// set decodes the raw item and updates or appends it
+func (l *List[K, V]) set(index K, raw json.RawMessage) error {
+
+	var (
+		item V
+		err  error
+	)
+
+	if l.decoder != nil {
+		item, err = l.decoder(index, raw)
+	} else {
+		err = json.Unmarshal(raw, &item)
+	}
+	if err != nil {
+		return err
+	}
+
+	if !l.Update(index, item) {
+		_ = l.PushBack(index, item)
+	}
+
+	return nil
+}
+
+// marshalKey encodes a list index as a json object key
+func marshalKey[K comparable](index K) ([]byte, error) {
+
+	key, err := json.Marshal(index)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(key) > 0 && key[0] == '"' {
+		return key, nil
+	}
+
+	return json.Marshal(string(key))
+}
+
+// unmarshalKey decodes a json object key into a list index
+func unmarshalKey[K comparable](key string) (K, error) {
+
+	var index K
+
+	quoted, err := json.Marshal(key)
+	if err != nil {
+		return index, err
+	}
+
+	if err := json.Unmarshal(quoted, &index); err == nil {
+		return index, nil
+	}
+
+	err = json.Unmarshal([]byte(key), &index)
+
+	return index, err
+}
+
+// jsonMessage is a single queue message in json
+type jsonMessage[T any] struct {
+	Digest  string     `json:"digest"`
+	Message T          `json:"message"`
+	Expires *time.Time `json:"expires,omitempty"`
+}
+
+// MarshalJSON encodes the queue as a json array of messages in order, with
+// the absolute ttl expiry of each message that has one. Expired, leased and
+// delayed messages are left out, and the queue is not modified.
+func (q *Queue[T]) MarshalJSON() ([]byte, error) {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	now := q.clock.Now()
+	messages := make([]jsonMessage[T], 0, q.messages.Len())
+
+	for e := q.messages.items.Front(); e != nil; e = e.Next() {
+		wrapper := e.Value.(*itemWrapper[string, T])
+
+		msg := jsonMessage[T]{
+			Digest:  wrapper.index,
+			Message: wrapper.item,
+		}
+		if ctrl, ok := q.ttl.get(wrapper.index); ok {
+			if ctrl.ExpiredAt(now) {
+				continue
+			}
+			expires := ctrl.Expires
+			msg.Expires = &expires
+		}
+
+		messages = append(messages, msg)
+	}
+
+	return json.Marshal(messages)
+}
+
+// UnmarshalJSON decodes a json array of messages written by MarshalJSON and
+// pushes them to the back of the queue in order, subject to de-duplication and
+// the max queue length. Messages with an expires time get a ttl without a
+// callback, and messages which have already expired are skipped. The queue
+// must have been created with NewQueue.
+func (q *Queue[T]) UnmarshalJSON(data []byte) error {
+
+	if q.clock == nil {
+		return errors.New("flexqueue: cannot unmarshal into a Queue not created by NewQueue")
+	}
+
+	var messages []jsonMessage[T]
+	if err := json.Unmarshal(data, &messages); err != nil {
+		return err
+	}
+
+	q.Lock()
+	defer q.unlock()
+
+	now := q.clock.Now()
+
+	for _, msg := range messages {
+		if msg.Expires == nil {
+			_ = q.pushFB(false, msg.Digest, msg.Message)
+			continue
+		}
+		ctrl := &TTLControl[T]{
+			Expires: *msg.Expires,
+		}
+		if !ctrl.ExpiredAt(now) {
+			_ = q.push(false, msg.Digest, msg.Message, ctrl)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,186 @@
+package flexqueue_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestListJSONObject(t *testing.T) {
+
+	list := flexqueue.NewFlexList()
+	list.PushBack("C", 1)
+	list.PushBack("A", "two")
+	list.PushBack("B", []int{3})
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatalf("expected marshal to succeed but got %v instead", err)
+	}
+
+	expected := `{"C":1,"A":"two","B":[3]}`
+	if string(data) != expected {
+		t.Errorf("expected json to be %v but got %v instead", expected, string(data))
+	}
+
+	decoded := flexqueue.NewFlexList()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("expected unmarshal to succeed but got %v instead", err)
+	}
+
+	for _, index := range []string{"C", "A", "B"} {
+		i, _, ok := decoded.PullFront()
+		if !ok || i != index {
+			t.Errorf("expected pulled index to be %v but got %v instead", index, i)
+		}
+	}
+}
+
+func TestListJSONPairs(t *testing.T) {
+
+	list := flexqueue.NewList[int, Item]().SetJSONFormat(flexqueue.JSONPairs)
+	list.PushBack(3, Item{ID: "C"})
+	list.PushBack(1, Item{ID: "A"})
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatalf("expected marshal to succeed but got %v instead", err)
+	}
+
+	expected := `[{"index":3,"item":{"ID":"C"}},{"index":1,"item":{"ID":"A"}}]`
+	if string(data) != expected {
+		t.Errorf("expected json to be %v but got %v instead", expected, string(data))
+	}
+
+	var decoded flexqueue.List[int, Item]
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("expected unmarshal to succeed but got %v instead", err)
+	}
+
+	index, item, ok := decoded.ReadFront()
+	if !ok || index != 3 || item.ID != "C" {
+		t.Errorf("expected front to be 3 C but got %v %v instead", index, item.ID)
+	}
+	if decoded.Len() != 2 {
+		t.Errorf("expected len to be %v but got %v instead", 2, decoded.Len())
+	}
+}
+
+func TestListJSONNumericKeys(t *testing.T) {
+
+	list := flexqueue.NewList[int, string]()
+	list.PushBack(2, "B")
+	list.PushBack(1, "A")
+
+	data, err := json.Marshal(list)
+	if err != nil {
+		t.Fatalf("expected marshal to succeed but got %v instead", err)
+	}
+
+	expected := `{"2":"B","1":"A"}`
+	if string(data) != expected {
+		t.Errorf("expected json to be %v but got %v instead", expected, string(data))
+	}
+
+	decoded := flexqueue.NewList[int, string]()
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("expected unmarshal to succeed but got %v instead", err)
+	}
+
+	index, item, _ := decoded.ReadFront()
+	if index != 2 || item != "B" {
+		t.Errorf("expected front to be 2 B but got %v %v instead", index, item)
+	}
+}
+
+func TestListJSONMerge(t *testing.T) {
+
+	list := flexqueue.NewList[string, int]()
+	list.PushBack("A", 1)
+	list.PushBack("B", 2)
+
+	if err := json.Unmarshal([]byte(`{"C":3,"A":10}`), list); err != nil {
+		t.Fatalf("expected unmarshal to succeed but got %v instead", err)
+	}
+
+	data, _ := json.Marshal(list)
+
+	expected := `{"A":10,"B":2,"C":3}`
+	if string(data) != expected {
+		t.Errorf("expected json to be %v but got %v instead", expected, string(data))
+	}
+}
+
+func TestListJSONItemDecoder(t *testing.T) {
+
+	list := flexqueue.NewFlexList().SetItemDecoder(
+		func(index string, raw json.RawMessage) (interface{}, error) {
+			var item Item
+			err := json.Unmarshal(raw, &item)
+			return item, err
+		})
+
+	if err := json.Unmarshal([]byte(`{"A":{"ID":"A"}}`), list); err != nil {
+		t.Fatalf("expected unmarshal to succeed but got %v instead", err)
+	}
+
+	item, _ := list.Read("A")
+	if _, ok := item.(Item); !ok {
+		t.Errorf("expected item to be %T but got %T instead", Item{}, item)
+	}
+}
+
+func TestQueueJSON(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock)
+
+	cbFunc := func(digest string, message Message) {}
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBackTTL("B", Message{Digest: "B"}, time.Second, cbFunc)
+	queue.PushBackTTL("C", Message{Digest: "C"}, time.Hour, cbFunc)
+	queue.PushBack("D", Message{Digest: "D"})
+	queue.LeaseBack(time.Minute)
+
+	clock.Advance(time.Minute)
+
+	data, err := json.Marshal(queue)
+	if err != nil {
+		t.Fatalf("expected marshal to succeed but got %v instead", err)
+	}
+
+	// Marshalling does not prune the expired message
+	if queue.Len() != 3 {
+		t.Errorf("expected len to be %v but got %v instead", 3, queue.Len())
+	}
+
+	decoded := flexqueue.NewQueueWithClock[Message](clock)
+	if err := json.Unmarshal(data, decoded); err != nil {
+		t.Fatalf("expected unmarshal to succeed but got %v instead", err)
+	}
+
+	digests := drain(decoded)
+	if len(digests) != 2 || digests[0] != "A" || digests[1] != "C" {
+		t.Errorf("expected digests to be [A C] but got %v instead", digests)
+	}
+
+	decoded = flexqueue.NewQueueWithClock[Message](clock)
+	_ = json.Unmarshal(data, decoded)
+	clock.Advance(time.Hour)
+
+	if decoded.Has("C") {
+		t.Errorf("expected C to keep its expiry")
+	}
+}
+
+func TestQueueJSONZeroValue(t *testing.T) {
+
+	var queue flexqueue.Queue[Message]
+
+	if err := json.Unmarshal([]byte(`[]`), &queue); err == nil {
+		t.Errorf("expected unmarshal into a zero value queue to fail")
+	}
+}
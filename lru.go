@@ -0,0 +1,303 @@
+package flexqueue
+
+import (
+	"sync"
+	"time"
+)
+
+// LRU is a thread safe least recently used cache with a fixed capacity. Entries
+// are kept in a List ordered from the most recently used at the front to the
+// least recently used at the back, which is evicted first when the cache is
+// full. Entries may optionally be given a TTL in the same way as queue messages.
+type LRU[V any] struct {
+	sync.RWMutex
+	entries  List[string, V]
+	ttl      expiryIndex[TTLControl[V]]
+	capacity int
+	onEvict  EvictFunc[V]
+	stats    LRUStats
+	clock    Clock
+	deferred []func()
+}
+
+// FlexLRU is the non-generic LRU cache holding interface{} values, in line
+// with FlexList and FlexQueue.
+type FlexLRU = LRU[interface{}]
+
+// LRUStats is a snapshot of the cache statistics
+type LRUStats struct {
+	Hits        uint64 // The number of Get calls which found an entry
+	Misses      uint64 // The number of Get calls which did not find an entry
+	Evictions   uint64 // The number of entries evicted to stay within capacity
+	Expirations uint64 // The number of entries removed because their TTL expired
+}
+
+// NewLRU is a factory method for creating a new LRU cache which holds at most
+// capacity entries. Use NoMax for a cache without a capacity limit.
+func NewLRU[V any](capacity int) *LRU[V] {
+	return NewLRUWithClock[V](capacity, SystemClock{})
+}
+
+// NewLRUWithClock is a factory method for creating a new LRU cache which uses
+// the given clock for all TTL timing.
+func NewLRUWithClock[V any](capacity int, clock Clock) *LRU[V] {
+
+	if capacity <= NoMax {
+		capacity = NoMax
+	}
+
+	return &LRU[V]{
+		entries:  *NewList[string, V](),
+		ttl:      newExpiryIndex[TTLControl[V]](),
+		capacity: capacity,
+		clock:    clock,
+	}
+}
+
+// NewFlexLRU is a factory method for creating a new flex LRU cache. It is
+// important to use this method to properly initialize the internal structs.
+func NewFlexLRU(capacity int) *FlexLRU {
+	return NewLRU[interface{}](capacity)
+}
+
+// NewFlexLRUWithClock is a factory method for creating a new flex LRU cache
+// which uses the given clock for all TTL timing.
+func NewFlexLRUWithClock(capacity int, clock Clock) *FlexLRU {
+	return NewLRUWithClock[interface{}](capacity, clock)
+}
+
+// SetEvictionCallback sets a callback which is fired for every entry that is
+// evicted to keep the cache within its capacity. Entries which expire fire
+// their own TTL callback instead. Like the queue, eviction and TTL callbacks
+// run after the cache lock is released so they may call back into the cache.
+func (c *LRU[V]) SetEvictionCallback(callback EvictFunc[V]) *LRU[V] {
+
+	c.Lock()
+	defer c.unlock()
+
+	c.onEvict = callback
+	return c
+}
+
+// Get will return the value for the key and promote the entry to the most
+// recently used. If the entry has expired then it is removed and treated as a
+// miss.
+// Returns:
+// * V: The value
+// * bool: true if the key was found or false if not found
+func (c *LRU[V]) Get(key string) (V, bool) {
+
+	c.Lock()
+	defer c.unlock()
+
+	if !c.pruneEntry(key) {
+		if value, ok := c.entries.Read(key); ok {
+			_ = c.entries.MoveToFront(key)
+			c.stats.Hits++
+			return value, true
+		}
+	}
+
+	c.stats.Misses++
+
+	var value V
+	return value, false
+}
+
+// Peek will return the value for the key without promoting the entry or
+// counting towards the hit and miss statistics.
+// Returns:
+// * V: The value
+// * bool: true if the key was found or false if not found
+func (c *LRU[V]) Peek(key string) (V, bool) {
+
+	c.Lock()
+	defer c.unlock()
+
+	if c.pruneEntry(key) {
+		var value V
+		return value, false
+	}
+
+	return c.entries.Read(key)
+}
+
+// Put will add or replace the entry for the key as the most recently used. Any
+// TTL the entry previously had is removed. If the cache is over capacity then
+// expired entries are removed first, followed by the least recently used.
+// Returns:
+// * bool: true if an entry was evicted to make room
+func (c *LRU[V]) Put(key string, value V) bool {
+
+	c.Lock()
+	defer c.unlock()
+
+	return c.put(key, value, nil)
+}
+
+// PutTTL will add or replace the entry for the key as the most recently used.
+// It behaves identical to Put except that it attaches a TTL and expiration
+// callback to the entry.
+// Returns:
+// * bool: true if an entry was evicted to make room
+func (c *LRU[V]) PutTTL(key string, value V, ttl time.Duration, callback ExpiryFunc[V]) bool {
+
+	c.Lock()
+	defer c.unlock()
+
+	return c.put(key, value, &TTLControl[V]{
+		Expires:  c.clock.Now().Add(ttl),
+		Callback: callback,
+	})
+}
+
+// put will add or replace the entry and evict entries over the capacity
+func (c *LRU[V]) put(key string, value V, ctrl *TTLControl[V]) bool {
+
+	if c.entries.Update(key, value) {
+		_ = c.entries.MoveToFront(key)
+	} else {
+		_ = c.entries.PushFront(key, value)
+	}
+
+	if ctrl != nil {
+		c.ttl.set(key, *ctrl, ctrl.Expires)
+	} else {
+		_ = c.ttl.delete(key)
+	}
+
+	if !c.isOver() {
+		return false
+	}
+
+	c.prune()
+
+	evicted := false
+	for c.isOver() {
+		evictKey, evictValue, _ := c.entries.PullBack()
+		_ = c.ttl.delete(evictKey)
+		c.stats.Evictions++
+		evicted = true
+		if onEvict := c.onEvict; onEvict != nil {
+			c.later(func() {
+				onEvict(evictKey, evictValue)
+			})
+		}
+	}
+
+	return evicted
+}
+
+// Remove will delete the entry for the key without firing any callback.
+// Returns:
+// * bool: true if the entry was removed and false if not found
+func (c *LRU[V]) Remove(key string) bool {
+
+	c.Lock()
+	defer c.unlock()
+
+	_ = c.ttl.delete(key)
+
+	return c.entries.Remove(key)
+}
+
+// Prune will remove all expired entries and fire their TTL callbacks.
+func (c *LRU[V]) Prune() {
+
+	c.Lock()
+	defer c.unlock()
+
+	c.prune()
+}
+
+// Len returns the number of entries in the cache. Like the queue this does not
+// perform TTL analysis so expired entries may be counted. Call Prune first for
+// an exact count.
+func (c *LRU[V]) Len() int {
+
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.entries.Len()
+}
+
+// Capacity returns the maximum number of entries the cache can hold. If there
+// is no limit then this will return -1.
+func (c *LRU[V]) Capacity() int {
+	return c.capacity
+}
+
+// Stats returns a snapshot of the cache statistics.
+func (c *LRU[V]) Stats() LRUStats {
+
+	c.RLock()
+	defer c.RUnlock()
+
+	return c.stats
+}
+
+// isOver returns true if the cache holds more entries than its capacity
+func (c *LRU[V]) isOver() bool {
+	return c.capacity > NoMax && c.entries.Len() > c.capacity
+}
+
+// prune will remove every expired entry in expiry order
+func (c *LRU[V]) prune() {
+
+	now := c.clock.Now()
+
+	for {
+		key, ctrl, _, ok := c.ttl.peek()
+		if !ok || !ctrl.ExpiredAt(now) {
+			return
+		}
+		c.expireEntry(key, ctrl)
+	}
+}
+
+// pruneEntry will remove the entry for the key if it has expired
+func (c *LRU[V]) pruneEntry(key string) bool {
+
+	ctrl, ok := c.ttl.get(key)
+	if ok && ctrl.ExpiredAt(c.clock.Now()) {
+		c.expireEntry(key, ctrl)
+		return true
+	}
+
+	return false
+}
+
+// expireEntry will remove the entry and fire its ttl callback
+func (c *LRU[V]) expireEntry(key string, ctrl TTLControl[V]) {
+
+	value, _ := c.entries.Pull(key)
+	_ = c.ttl.delete(key)
+	c.stats.Expirations++
+
+	if ctrl.Callback != nil {
+		c.later(func() {
+			ctrl.Callback(key, value)
+		})
+	}
+}
+
+// later will queue a callback to run once the cache lock is released. It must
+// be called with the cache lock held.
+func (c *LRU[V]) later(fn func()) {
+	c.deferred = append(c.deferred, fn)
+}
+
+// unlock will release the cache lock and then run the callbacks which were
+// deferred while it was held, in the same way as the queue. Since the lock is
+// not held callbacks may call back into the cache.
+func (c *LRU[V]) unlock() {
+
+	deferred := c.deferred
+	c.deferred = nil
+
+	c.Unlock()
+
+	if len(deferred) > 0 {
+		runDeferred(deferred)
+	}
+}
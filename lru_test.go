@@ -0,0 +1,144 @@
+package flexqueue_test
+
+import (
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestLRU(t *testing.T) {
+
+	evicted := []string{}
+	cache := flexqueue.NewLRU[int](3).SetEvictionCallback(func(key string, value int) {
+		evicted = append(evicted, key)
+	})
+
+	cache.Put("A", 1)
+	cache.Put("B", 2)
+	cache.Put("C", 3)
+
+	// A becomes the most recently used so B is evicted next
+	if value, ok := cache.Get("A"); !ok || value != 1 {
+		t.Errorf("expected value of A to be %v but got %v instead", 1, value)
+	}
+	if cache.Put("D", 4) != true {
+		t.Errorf("expected put of D to evict")
+	}
+	if cache.Put("C", 30) != false {
+		t.Errorf("expected put of existing C not to evict")
+	}
+	cache.Put("E", 5)
+
+	if strings.Join(evicted, "") != "BA" {
+		t.Errorf("expected evicted to be %v but got %v instead", "BA", evicted)
+	}
+	if _, ok := cache.Get("B"); ok {
+		t.Errorf("expected B to have been evicted")
+	}
+	if value, _ := cache.Peek("C"); value != 30 {
+		t.Errorf("expected value of C to be %v but got %v instead", 30, value)
+	}
+	if cache.Len() != 3 {
+		t.Errorf("expected len to be %v but got %v instead", 3, cache.Len())
+	}
+
+	expected := flexqueue.LRUStats{Hits: 1, Misses: 1, Evictions: 2}
+	if stats := cache.Stats(); stats != expected {
+		t.Errorf("expected stats to be %+v but got %+v instead", expected, stats)
+	}
+}
+
+func TestLRUTTL(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	cache := flexqueue.NewFlexLRUWithClock(2, clock)
+
+	expired := []string{}
+	cbFunc := func(key string, value interface{}) {
+		expired = append(expired, key)
+	}
+
+	cache.PutTTL("A", 1, time.Second, cbFunc)
+	cache.PutTTL("B", 2, time.Minute, cbFunc)
+
+	clock.Advance(time.Second * 2)
+
+	// The expired entry makes room rather than evicting the least recently used
+	if cache.Put("C", 3) {
+		t.Errorf("expected put of C not to evict")
+	}
+	if strings.Join(expired, "") != "A" {
+		t.Errorf("expected expired to be %v but got %v instead", "A", expired)
+	}
+
+	// Put without a ttl clears the existing ttl
+	cache.Put("B", 20)
+	clock.Advance(time.Hour)
+
+	if value, ok := cache.Get("B"); !ok || value != 20 {
+		t.Errorf("expected value of B to be %v but got %v instead", 20, value)
+	}
+
+	cache.PutTTL("C", 3, time.Second, cbFunc)
+	clock.Advance(time.Second * 2)
+
+	if _, ok := cache.Get("C"); ok {
+		t.Errorf("expected C to have expired")
+	}
+
+	stats := cache.Stats()
+	if stats.Expirations != 2 || stats.Misses != 1 {
+		t.Errorf("expected 2 expirations and 1 miss but got %+v instead", stats)
+	}
+}
+
+func TestLRUConcurrent(t *testing.T) {
+
+	cache := flexqueue.NewLRU[int](10)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				key := string(rune('A' + (i+j)%20))
+				cache.Put(key, j)
+				cache.Get(key)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if cache.Len() != 10 {
+		t.Errorf("expected len to be %v but got %v instead", 10, cache.Len())
+	}
+}
+
+func TestLRUCallbackReentry(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	cache := flexqueue.NewLRUWithClock[int](1, clock)
+
+	// Callbacks run once the lock is released so they can call back in
+	lens := []int{}
+	cache.SetEvictionCallback(func(key string, value int) {
+		lens = append(lens, cache.Len())
+	})
+	cbFunc := func(key string, value int) {
+		lens = append(lens, cache.Len())
+	}
+
+	cache.Put("A", 1)
+	cache.PutTTL("B", 2, time.Second, cbFunc)
+
+	clock.Advance(time.Second * 2)
+	cache.Prune()
+
+	if len(lens) != 2 || lens[0] != 1 || lens[1] != 0 {
+		t.Errorf("expected callback lens to be %v but got %v instead", []int{1, 0}, lens)
+	}
+}
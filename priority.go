@@ -0,0 +1,595 @@
+package flexqueue
+
+import (
+	"sync"
+	"time"
+)
+
+// PriorityQueue is a thread safe queue made up of a fixed number of priority
+// lanes. Each lane is an ordered list which supports FIFO and LIFO access in
+// the same way as Queue, and pulls are always served from the highest priority
+// lane which is not empty. De-duplication, TTL and the max length apply across
+// all of the lanes.
+type PriorityQueue[T any] struct {
+	sync.RWMutex
+	lanes      []*List[string, prioritized[T]]
+	priorities map[string]int
+	ttl        expiryIndex[TTLControl[T]]
+	max        int
+	aging      time.Duration
+	clock      Clock
+	deferred   []func()
+}
+
+// FlexPriorityQueue is the non-generic priority queue holding interface{}
+// messages, in line with FlexQueue.
+type FlexPriorityQueue = PriorityQueue[interface{}]
+
+// prioritized retains the time a message was pushed into its lane for aging
+type prioritized[T any] struct {
+	message T
+	pushed  time.Time
+}
+
+// NewPriorityQueue is a factory method for creating a new priority queue with
+// the given number of lanes. Priorities run from 0, the lowest, to levels-1,
+// the highest. A queue always has at least one lane.
+func NewPriorityQueue[T any](levels int) *PriorityQueue[T] {
+	return NewPriorityQueueWithClock[T](levels, SystemClock{})
+}
+
+// NewPriorityQueueWithClock is a factory method for creating a new priority
+// queue which uses the given clock for all TTL and aging timing.
+func NewPriorityQueueWithClock[T any](levels int, clock Clock) *PriorityQueue[T] {
+
+	if levels < 1 {
+		levels = 1
+	}
+
+	q := &PriorityQueue[T]{
+		lanes:      make([]*List[string, prioritized[T]], levels),
+		priorities: make(map[string]int),
+		ttl:        newExpiryIndex[TTLControl[T]](),
+		max:        NoMax,
+		clock:      clock,
+	}
+	for i := range q.lanes {
+		q.lanes[i] = NewList[string, prioritized[T]]()
+	}
+
+	return q
+}
+
+// NewFlexPriorityQueue is a factory method for creating a new flex priority
+// queue. It is important to use this method to properly initialize the
+// internal structs.
+func NewFlexPriorityQueue(levels int) *FlexPriorityQueue {
+	return NewPriorityQueue[interface{}](levels)
+}
+
+// NewFlexPriorityQueueWithClock is a factory method for creating a new flex
+// priority queue which uses the given clock for all TTL and aging timing.
+func NewFlexPriorityQueueWithClock(levels int, clock Clock) *FlexPriorityQueue {
+	return NewPriorityQueueWithClock[interface{}](levels, clock)
+}
+
+// SetMax sets the maximum number of messages the queue can hold across all of
+// the lanes. Use NoMax for no limit, which is the default.
+func (q *PriorityQueue[T]) SetMax(max int) *PriorityQueue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	if max > NoMax {
+		q.max = max
+	} else {
+		q.max = NoMax
+	}
+	return q
+}
+
+// SetAging stops low priority messages from starving. A message is treated as
+// one priority level higher for every interval it has waited when choosing the
+// lane to serve, and ties go to the message which has waited longest. Use 0 to
+// disable aging, which is the default.
+func (q *PriorityQueue[T]) SetAging(interval time.Duration) *PriorityQueue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	if interval > 0 {
+		q.aging = interval
+	} else {
+		q.aging = 0
+	}
+	return q
+}
+
+// Levels returns the number of priority lanes
+func (q *PriorityQueue[T]) Levels() int {
+	return len(q.lanes)
+}
+
+// PushFront will add a new message to the front of the lane for the priority.
+// Priorities outside of the lanes are clamped to the lowest or highest lane. If
+// the digest already exists in any lane then the push is ignored and reported
+// as successful, the same as Queue.
+// Returns:
+// * bool: true if the message is in the queue and false if the queue is full
+func (q *PriorityQueue[T]) PushFront(priority int, digest string, message T) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.push(true, priority, digest, message, nil)
+}
+
+// PushBack will add a new message to the back of the lane for the priority. It
+// otherwise behaves the same as PushFront.
+// Returns:
+// * bool: true if the message is in the queue and false if the queue is full
+func (q *PriorityQueue[T]) PushBack(priority int, digest string, message T) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.push(false, priority, digest, message, nil)
+}
+
+// PushFrontTTL will add a new message to the front of the lane for the
+// priority. It behaves identical to PushFront except that it attaches a TTL
+// and expiration callback to the message.
+// Returns:
+// * bool: true if the message is in the queue and false if the queue is full
+// or the ttl is already expired
+func (q *PriorityQueue[T]) PushFrontTTL(priority int, digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushTTL(true, priority, digest, message, ttl, callback)
+}
+
+// PushBackTTL will add a new message to the back of the lane for the priority.
+// It behaves identical to PushBack except that it attaches a TTL and
+// expiration callback to the message.
+// Returns:
+// * bool: true if the message is in the queue and false if the queue is full
+// or the ttl is already expired
+func (q *PriorityQueue[T]) PushBackTTL(priority int, digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pushTTL(false, priority, digest, message, ttl, callback)
+}
+
+// pushTTL will push a message like push with a new ttl control. If the ttl is
+// already expired then the callback is fired and the message is not added, the
+// same as Queue.
+func (q *PriorityQueue[T]) pushTTL(front bool, priority int, digest string, message T, ttl time.Duration, callback ExpiryFunc[T]) bool {
+
+	ctrl := q.newTTL(ttl, callback)
+	if ctrl.ExpiredAt(q.clock.Now()) {
+		q.expired(ctrl.Callback, digest, message)
+		return false
+	}
+
+	return q.push(front, priority, digest, message, ctrl)
+}
+
+// push will add a message to a lane unless it is a duplicate or the queue is
+// full, and attach the ttl control to it if one is given
+func (q *PriorityQueue[T]) push(front bool, priority int, digest string, message T, ctrl *TTLControl[T]) bool {
+
+	// An expired message with the same digest does not count as a duplicate
+	_ = q.pruneMessage(digest)
+
+	if _, ok := q.priorities[digest]; ok {
+		return true
+	}
+
+	if q.max > NoMax && len(q.priorities) >= q.max {
+		return false
+	}
+
+	priority = q.clamp(priority)
+	item := prioritized[T]{
+		message: message,
+		pushed:  q.clock.Now(),
+	}
+
+	if front {
+		_ = q.lanes[priority].PushFront(digest, item)
+	} else {
+		_ = q.lanes[priority].PushBack(digest, item)
+	}
+	q.priorities[digest] = priority
+
+	if ctrl != nil {
+		q.ttl.set(digest, *ctrl, ctrl.Expires)
+	}
+
+	return true
+}
+
+// PullFront will remove and return the message at the front of the highest
+// priority lane which is not empty.
+// Returns:
+// * string: The message digest
+// * T: The message
+// * bool: true if a message was found or false if the queue is empty
+func (q *PriorityQueue[T]) PullFront() (string, T, bool) {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pullFB(true)
+}
+
+// PullBack will remove and return the message at the back of the highest
+// priority lane which is not empty.
+// Returns:
+// * string: The message digest
+// * T: The message
+// * bool: true if a message was found or false if the queue is empty
+func (q *PriorityQueue[T]) PullBack() (string, T, bool) {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.pullFB(false)
+}
+
+// pullFB will remove and return the message from the end of the lane to serve
+func (q *PriorityQueue[T]) pullFB(front bool) (string, T, bool) {
+
+	digest, message, ok := q.readFB(front)
+	if ok {
+		_ = q.lanes[q.priorities[digest]].Remove(digest)
+		q.forget(digest)
+	}
+
+	return digest, message, ok
+}
+
+// ReadFront will return the message PullFront would return without removing it
+// Returns:
+// * string: The message digest
+// * T: The message
+// * bool: true if a message was found or false if the queue is empty
+func (q *PriorityQueue[T]) ReadFront() (string, T, bool) {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.readFB(true)
+}
+
+// ReadBack will return the message PullBack would return without removing it
+// Returns:
+// * string: The message digest
+// * T: The message
+// * bool: true if a message was found or false if the queue is empty
+func (q *PriorityQueue[T]) ReadBack() (string, T, bool) {
+
+	q.Lock()
+	defer q.unlock()
+
+	return q.readFB(false)
+}
+
+// readFB will return the message at the end of the lane to serve. Without aging
+// this is the highest lane which is not empty. With aging each lane is scored
+// by how long the message at that end has waited.
+func (q *PriorityQueue[T]) readFB(front bool) (string, T, bool) {
+
+	var (
+		digest  string
+		message T
+		found   bool
+		best    int
+		oldest  time.Time
+	)
+
+	now := q.clock.Now()
+
+	for p := len(q.lanes) - 1; p >= 0; p-- {
+		d, item, ok := q.readLane(p, front)
+		if !ok {
+			continue
+		}
+
+		score := p
+		if q.aging > 0 {
+			score += int(now.Sub(item.pushed) / q.aging)
+		}
+		if !found || score > best || (score == best && item.pushed.Before(oldest)) {
+			digest, message, found, best, oldest = d, item.message, true, score, item.pushed
+		}
+		if q.aging == 0 {
+			break
+		}
+	}
+
+	return digest, message, found
+}
+
+// readLane will return the unexpired message at the end of the lane
+func (q *PriorityQueue[T]) readLane(priority int, front bool) (string, prioritized[T], bool) {
+
+	for {
+		var (
+			digest string
+			item   prioritized[T]
+			ok     bool
+		)
+
+		if front {
+			digest, item, ok = q.lanes[priority].ReadFront()
+		} else {
+			digest, item, ok = q.lanes[priority].ReadBack()
+		}
+
+		if !ok || !q.pruneMessage(digest) {
+			return digest, item, ok
+		}
+	}
+}
+
+// Pull will remove and return a message by its digest from any lane.
+// Returns:
+// * T: The message
+// * bool: true if the message was found or false if not found
+func (q *PriorityQueue[T]) Pull(digest string) (T, bool) {
+
+	q.Lock()
+	defer q.unlock()
+
+	if q.pruneMessage(digest) {
+		var message T
+		return message, false
+	}
+
+	priority, ok := q.priorities[digest]
+	if !ok {
+		var message T
+		return message, false
+	}
+
+	item, _ := q.lanes[priority].Pull(digest)
+	q.forget(digest)
+
+	return item.message, true
+}
+
+// Read will return a message by its digest from any lane without removing it.
+// Returns:
+// * T: The message
+// * bool: true if the message was found or false if not found
+func (q *PriorityQueue[T]) Read(digest string) (T, bool) {
+
+	q.Lock()
+	defer q.unlock()
+
+	if !q.pruneMessage(digest) {
+		if priority, ok := q.priorities[digest]; ok {
+			item, _ := q.lanes[priority].Read(digest)
+			return item.message, true
+		}
+	}
+
+	var message T
+	return message, false
+}
+
+// Update will update a message without changing its lane, position, ttl or
+// aging.
+// Returns:
+// * bool: true if the message was updated and false if not found
+func (q *PriorityQueue[T]) Update(digest string, message T) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	if q.pruneMessage(digest) {
+		return false
+	}
+
+	priority, ok := q.priorities[digest]
+	if !ok {
+		return false
+	}
+
+	item, _ := q.lanes[priority].Read(digest)
+	item.message = message
+
+	return q.lanes[priority].Update(digest, item)
+}
+
+// Remove will delete a message from any lane without firing its ttl callback.
+// Returns:
+// * bool: true if the message was removed and false if not found
+func (q *PriorityQueue[T]) Remove(digest string) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	priority, ok := q.priorities[digest]
+	if ok {
+		_ = q.lanes[priority].Remove(digest)
+		q.forget(digest)
+	}
+
+	return ok
+}
+
+// Has returns true if the queue contains the digest in any lane
+func (q *PriorityQueue[T]) Has(digest string) bool {
+
+	q.Lock()
+	defer q.unlock()
+
+	if q.pruneMessage(digest) {
+		return false
+	}
+
+	_, ok := q.priorities[digest]
+
+	return ok
+}
+
+// Priority returns the lane of a message.
+// Returns:
+// * int: The priority of the lane holding the message
+// * bool: true if the message was found or false if not found
+func (q *PriorityQueue[T]) Priority(digest string) (int, bool) {
+
+	q.Lock()
+	defer q.unlock()
+
+	if q.pruneMessage(digest) {
+		return 0, false
+	}
+
+	priority, ok := q.priorities[digest]
+
+	return priority, ok
+}
+
+// Prune will remove all expired messages from every lane and fire their ttl
+// callbacks in expiry order.
+func (q *PriorityQueue[T]) Prune() {
+
+	q.Lock()
+	defer q.unlock()
+
+	now := q.clock.Now()
+
+	for {
+		digest, ctrl, _, ok := q.ttl.peek()
+		if !ok || !ctrl.ExpiredAt(now) {
+			return
+		}
+		q.expireMessage(digest, ctrl)
+	}
+}
+
+// Len returns the number of messages across all lanes. Like Queue this does
+// not perform TTL analysis so expired messages may be counted.
+func (q *PriorityQueue[T]) Len() int {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	return len(q.priorities)
+}
+
+// LaneLen returns the number of messages in the lane for the priority. The
+// priority is clamped the same way as a push.
+func (q *PriorityQueue[T]) LaneLen(priority int) int {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	return q.lanes[q.clamp(priority)].Len()
+}
+
+// Max returns the maximum number of messages the queue can hold. If there is
+// no message limit then this will return -1.
+func (q *PriorityQueue[T]) Max() int {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	return q.max
+}
+
+// IsFull returns true if the queue has reached its max length
+func (q *PriorityQueue[T]) IsFull() bool {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	return q.max > NoMax && len(q.priorities) >= q.max
+}
+
+// IsEmpty returns true if there are no messages in any lane
+func (q *PriorityQueue[T]) IsEmpty() bool {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	return len(q.priorities) == 0
+}
+
+// clamp will limit the priority to the range of lanes
+func (q *PriorityQueue[T]) clamp(priority int) int {
+
+	if priority < 0 {
+		return 0
+	}
+	if priority >= len(q.lanes) {
+		return len(q.lanes) - 1
+	}
+
+	return priority
+}
+
+// newTTL creates a ttl control for the duration based on the queue clock
+func (q *PriorityQueue[T]) newTTL(ttl time.Duration, callback ExpiryFunc[T]) *TTLControl[T] {
+	return &TTLControl[T]{
+		Expires:  q.clock.Now().Add(ttl),
+		Callback: callback,
+	}
+}
+
+// pruneMessage will expire the message if its ttl has passed
+func (q *PriorityQueue[T]) pruneMessage(digest string) bool {
+
+	ctrl, ok := q.ttl.get(digest)
+	if ok && ctrl.ExpiredAt(q.clock.Now()) {
+		q.expireMessage(digest, ctrl)
+		return true
+	}
+
+	return false
+}
+
+// expireMessage will remove the message and fire its ttl callback
+func (q *PriorityQueue[T]) expireMessage(digest string, ctrl TTLControl[T]) {
+
+	item, _ := q.lanes[q.priorities[digest]].Pull(digest)
+	q.forget(digest)
+	q.expired(ctrl.Callback, digest, item.message)
+}
+
+// expired will queue a ttl callback to run once the queue lock is released
+func (q *PriorityQueue[T]) expired(callback ExpiryFunc[T], digest string, message T) {
+	if callback != nil {
+		q.deferred = append(q.deferred, func() {
+			callback(digest, message)
+		})
+	}
+}
+
+// unlock will release the queue lock and then run the ttl callbacks which were
+// deferred while it was held, in the same way as Queue. Since the lock is not
+// held callbacks may call back into the queue.
+func (q *PriorityQueue[T]) unlock() {
+
+	deferred := q.deferred
+	q.deferred = nil
+
+	q.Unlock()
+
+	if len(deferred) > 0 {
+		runDeferred(deferred)
+	}
+}
+
+// forget will drop the per-message state once a message leaves the queue
+func (q *PriorityQueue[T]) forget(digest string) {
+	delete(q.priorities, digest)
+	_ = q.ttl.delete(digest)
+}
@@ -0,0 +1,159 @@
+package flexqueue_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+// drainPriority pulls every message from the front and returns the digests
+func drainPriority(queue *flexqueue.PriorityQueue[Message]) string {
+	digests := ""
+	for {
+		digest, _, ok := queue.PullFront()
+		if !ok {
+			return digests
+		}
+		digests += digest
+	}
+}
+
+func TestPriorityQueueLanes(t *testing.T) {
+
+	queue := flexqueue.NewPriorityQueue[Message](3)
+
+	queue.PushBack(0, "A", Message{Digest: "A"})
+	queue.PushBack(2, "B", Message{Digest: "B"})
+	queue.PushBack(1, "C", Message{Digest: "C"})
+	queue.PushBack(2, "D", Message{Digest: "D"})
+	queue.PushFront(1, "E", Message{Digest: "E"})
+	queue.PushBack(9, "F", Message{Digest: "F"})
+
+	// dedup applies across lanes and the original lane is kept
+	if !queue.PushBack(0, "B", Message{Digest: "B"}) {
+		t.Errorf("expected duplicate push to succeed")
+	}
+	if priority, _ := queue.Priority("B"); priority != 2 {
+		t.Errorf("expected priority of B to be %v but got %v instead", 2, priority)
+	}
+	if queue.LaneLen(2) != 3 {
+		t.Errorf("expected lane len to be %v but got %v instead", 3, queue.LaneLen(2))
+	}
+
+	if digest, _, _ := queue.PullBack(); digest != "F" {
+		t.Errorf("expected pulled digest to be %v but got %v instead", "F", digest)
+	}
+
+	digests := drainPriority(queue)
+	if digests != "BDECA" {
+		t.Errorf("expected digests to be %v but got %v instead", "BDECA", digests)
+	}
+}
+
+func TestPriorityQueueMax(t *testing.T) {
+
+	queue := flexqueue.NewPriorityQueue[Message](2).SetMax(2)
+
+	tests := []struct {
+		priority int
+		digest   string
+		ok       bool
+	}{
+		{0, "A", true},
+		{1, "B", true},
+		{1, "A", true},
+		{1, "C", false},
+	}
+
+	for _, test := range tests {
+		if ok := queue.PushBack(test.priority, test.digest, Message{Digest: test.digest}); ok != test.ok {
+			t.Errorf("expected push of %v to return %v but got %v instead", test.digest, test.ok, ok)
+		}
+	}
+
+	if !queue.IsFull() {
+		t.Errorf("expected queue to be full")
+	}
+}
+
+func TestPriorityQueueTTL(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewPriorityQueueWithClock[Message](2, clock)
+
+	expired := []string{}
+	cbFunc := func(digest string, message Message) {
+		expired = append(expired, message.Digest)
+	}
+
+	queue.PushBackTTL(1, "A", Message{Digest: "A"}, time.Second, cbFunc)
+	queue.PushBackTTL(0, "B", Message{Digest: "B"}, time.Minute, cbFunc)
+	queue.PushBack(0, "C", Message{Digest: "C"})
+
+	clock.Advance(time.Second * 2)
+
+	if digest, _, _ := queue.ReadFront(); digest != "B" {
+		t.Errorf("expected read digest to be %v but got %v instead", "B", digest)
+	}
+
+	clock.Advance(time.Minute)
+	queue.Prune()
+
+	if strings.Join(expired, "") != "AB" {
+		t.Errorf("expected expired to be %v but got %v instead", "AB", expired)
+	}
+	if queue.Len() != 1 {
+		t.Errorf("expected len to be %v but got %v instead", 1, queue.Len())
+	}
+}
+
+func TestPriorityQueueTTLCallbacks(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewPriorityQueueWithClock[Message](2, clock)
+
+	// Callbacks run once the lock is released so they can call back in
+	lens := []int{}
+	cbFunc := func(digest string, message Message) {
+		lens = append(lens, queue.Len())
+	}
+
+	// A ttl which is already expired is rejected and fires the callback
+	if ok := queue.PushBackTTL(1, "A", Message{Digest: "A"}, -time.Second, cbFunc); ok {
+		t.Errorf("expected push of expired ttl to be not ok but got ok")
+	}
+	if queue.Has("A") {
+		t.Errorf("expected message %v to not exist", "A")
+	}
+
+	queue.PushFrontTTL(0, "B", Message{Digest: "B"}, time.Second, cbFunc)
+	queue.PushBack(0, "C", Message{Digest: "C"})
+	clock.Advance(time.Second * 2)
+	queue.Prune()
+
+	if len(lens) != 2 || lens[0] != 0 || lens[1] != 1 {
+		t.Errorf("expected callback lens to be %v but got %v instead", []int{0, 1}, lens)
+	}
+}
+
+func TestPriorityQueueAging(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewPriorityQueueWithClock[Message](3, clock).SetAging(time.Second)
+
+	queue.PushBack(0, "A", Message{Digest: "A"})
+	clock.Advance(time.Second)
+	queue.PushBack(1, "B", Message{Digest: "B"})
+	clock.Advance(time.Second)
+	queue.PushBack(2, "C", Message{Digest: "C"})
+	queue.PushBack(2, "D", Message{Digest: "D"})
+
+	// A has aged two levels and B one level, so all three lanes tie and the
+	// longest waiting message is served first
+	digests := drainPriority(queue)
+	if digests != "ABCD" {
+		t.Errorf("expected digests to be %v but got %v instead", "ABCD", digests)
+	}
+}
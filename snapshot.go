@@ -0,0 +1,105 @@
+package flexqueue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// ErrBadSnapshot is returned when restoring from data which is not a complete
+// queue snapshot.
+var ErrBadSnapshot = errors.New("flexqueue: invalid snapshot")
+
+// snapshotMagic identifies the start of a snapshot and its format version
+var snapshotMagic = []byte("FLEXQSN1")
+
+// SnapshotOptions configures a queue restored with RestoreQueue
+type SnapshotOptions[T any] struct {
+	Codec    Codec[T]      // Converts messages from bytes, defaults to JSONCodec
+	OnExpire ExpiryFunc[T] // The ttl callback attached to restored messages
+	Clock    Clock         // The queue clock, defaults to SystemClock
+}
+
+// SetCodec sets the codec used to convert messages to bytes for snapshots.
+// The default is JSONCodec.
+func (q *Queue[T]) SetCodec(codec Codec[T]) *Queue[T] {
+
+	q.Lock()
+	defer q.unlock()
+
+	if codec != nil {
+		q.codec = codec
+	}
+	return q
+}
+
+// Snapshot will write a point-in-time copy of the queue to w, holding the
+// queue read lock so the copy is consistent. It includes the message order,
+// digests, payloads encoded with the queue codec, absolute ttl expiry times and
+// the max setting. Messages with an expired ttl are left out, leased messages
+// are written at the front so they are redelivered after a restore, and delayed
+// messages keep the time they become visible.
+func (q *Queue[T]) Snapshot(w io.Writer) error {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	header := append([]byte{}, snapshotMagic...)
+	header = appendVarint(header, int64(q.max))
+
+	if _, err := w.Write(header); err != nil {
+		return err
+	}
+
+	_, err := q.writeState(w, true)
+
+	return err
+}
+
+// RestoreQueue creates a new queue from a snapshot written by Snapshot.
+// Restored messages with a ttl get the OnExpire callback since callbacks can
+// not be persisted.
+func RestoreQueue[T any](r io.Reader, opts SnapshotOptions[T]) (*Queue[T], error) {
+
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec[T]{}
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock{}
+	}
+
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(snapshotMagic))
+	if _, err := io.ReadFull(br, magic); err != nil || !bytes.Equal(magic, snapshotMagic) {
+		return nil, ErrBadSnapshot
+	}
+
+	max, err := binary.ReadVarint(br)
+	if err != nil {
+		return nil, ErrBadSnapshot
+	}
+
+	q := NewQueueWithClock[T](opts.Clock).SetCodec(opts.Codec).SetMax(int(max))
+
+	for {
+		rec, _, err := readRecord(br)
+		if err == io.EOF {
+			return q, nil
+		}
+		if err != nil || (rec.op != opPushBack && rec.op != opPushDelayed) {
+			return nil, ErrBadSnapshot
+		}
+		if err := q.apply(rec, opts.OnExpire); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// RestoreFlexQueue creates a new flex queue from a snapshot written by
+// Snapshot using the default JSONCodec.
+func RestoreFlexQueue(r io.Reader) (*FlexQueue, error) {
+	return RestoreQueue[interface{}](r, SnapshotOptions[interface{}]{})
+}
@@ -0,0 +1,152 @@
+package flexqueue_test
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+func TestQueueSnapshotRestore(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock).SetMax(10)
+
+	cbFunc := func(digest string, message Message) {}
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBackTTL("B", Message{Digest: "B"}, time.Minute, cbFunc)
+	queue.PushBackTTL("C", Message{Digest: "C"}, time.Hour, cbFunc)
+	queue.PushBack("D", Message{Digest: "D", TTL: time.Second})
+	queue.LeaseBack(time.Minute)
+
+	// B has expired by the time of the snapshot
+	clock.Advance(time.Minute * 2)
+
+	var buf bytes.Buffer
+	if err := queue.Snapshot(&buf); err != nil {
+		t.Fatalf("expected snapshot error to be nil but got %v instead", err)
+	}
+
+	// the snapshot does not change the source queue
+	if queue.Len() != 3 || queue.Leased() != 1 {
+		t.Errorf("expected source len/leased to be %v/%v but got %v/%v instead", 3, 1, queue.Len(), queue.Leased())
+	}
+
+	expired := []string{}
+	restored, err := flexqueue.RestoreQueue(&buf, flexqueue.SnapshotOptions[Message]{
+		Clock: clock,
+		OnExpire: func(digest string, message Message) {
+			expired = append(expired, digest)
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected restore error to be nil but got %v instead", err)
+	}
+
+	if restored.Max() != 10 {
+		t.Errorf("expected restored max to be %v but got %v instead", 10, restored.Max())
+	}
+	if message, _ := restored.Read("D"); message.TTL != time.Second {
+		t.Errorf("expected restored payload to be %v but got %v instead", time.Second, message.TTL)
+	}
+
+	// the absolute expiry of C is restored
+	clock.Advance(time.Hour)
+
+	if digests := drain(restored); fmt.Sprint(digests) != fmt.Sprint([]string{"D", "A"}) {
+		t.Errorf("expected restored order to be %v but got %v instead", []string{"D", "A"}, digests)
+	}
+	if fmt.Sprint(expired) != fmt.Sprint([]string{"C"}) {
+		t.Errorf("expected restored expiry to fire for %v but got %v instead", []string{"C"}, expired)
+	}
+}
+
+func TestQueueSnapshotOrder(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	queue := flexqueue.NewQueueWithClock[Message](clock)
+
+	for _, digest := range []string{"A", "B", "C", "D", "E"} {
+		queue.PushBack(digest, Message{Digest: digest})
+	}
+	queue.LeaseFront(time.Minute * 2)
+	queue.LeaseBack(time.Minute)
+	queue.LeaseBack(time.Minute)
+	queue.PushBackDelayed("Y", Message{Digest: "Y"}, time.Hour)
+	queue.PushBackDelayed("X", Message{Digest: "X"}, time.Hour)
+	queue.PushBackDelayed("Z", Message{Digest: "Z"}, time.Minute)
+
+	// leased and delayed messages are written in a stable order
+	var first bytes.Buffer
+	_ = queue.Snapshot(&first)
+	for i := 0; i < 20; i++ {
+		var buf bytes.Buffer
+		_ = queue.Snapshot(&buf)
+		if !bytes.Equal(buf.Bytes(), first.Bytes()) {
+			t.Fatalf("expected every snapshot to be identical")
+		}
+	}
+
+	restored, err := flexqueue.RestoreQueue(&first, flexqueue.SnapshotOptions[Message]{Clock: clock})
+	if err != nil {
+		t.Fatalf("expected restore error to be nil but got %v instead", err)
+	}
+
+	// the leases which run out soonest are redelivered first
+	if digests := drain(restored); fmt.Sprint(digests) != fmt.Sprint([]string{"D", "E", "A", "B", "C"}) {
+		t.Errorf("expected restored order to be %v but got %v instead", []string{"D", "E", "A", "B", "C"}, digests)
+	}
+	if restored.Delayed() != 3 {
+		t.Errorf("expected restored delayed to be %v but got %v instead", 3, restored.Delayed())
+	}
+}
+
+func TestFlexQueueSnapshotRestore(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+	queue.PushBack("A", "a")
+	queue.PushBack("B", 2)
+
+	var buf bytes.Buffer
+	if err := queue.Snapshot(&buf); err != nil {
+		t.Fatalf("expected snapshot error to be nil but got %v instead", err)
+	}
+
+	restored, err := flexqueue.RestoreFlexQueue(&buf)
+	if err != nil {
+		t.Fatalf("expected restore error to be nil but got %v instead", err)
+	}
+	if restored.Max() != flexqueue.NoMax {
+		t.Errorf("expected restored max to be %v but got %v instead", flexqueue.NoMax, restored.Max())
+	}
+
+	// json decodes numbers into float64
+	if message, _ := restored.Read("B"); message != float64(2) {
+		t.Errorf("expected restored message to be %v but got %v instead", 2, message)
+	}
+}
+
+func TestRestoreBadSnapshot(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+	queue.PushBack("A", "a")
+
+	var buf bytes.Buffer
+	queue.Snapshot(&buf)
+
+	tcases := map[string][]byte{
+		"empty":     {},
+		"not magic": []byte("not a snapshot"),
+		"truncated": buf.Bytes()[:buf.Len()-1],
+	}
+
+	for name, data := range tcases {
+		if _, err := flexqueue.RestoreFlexQueue(bytes.NewReader(data)); !errors.Is(err, flexqueue.ErrBadSnapshot) {
+			t.Errorf("expected %v restore error to be %v but got %v instead", name, flexqueue.ErrBadSnapshot, err)
+		}
+	}
+}
@@ -0,0 +1,735 @@
+package flexqueue
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// ErrNoLog is returned by the write-ahead log methods of a queue which was not
+// opened with OpenQueue.
+var ErrNoLog = errors.New("flexqueue: queue has no write-ahead log")
+
+// errCorruptRecord marks a log record which failed to decode
+var errCorruptRecord = errors.New("flexqueue: corrupt log record")
+
+// SyncPolicy decides when the write-ahead log is flushed to stable storage
+type SyncPolicy int
+
+const (
+	// SyncAlways flushes the log after every record. This is the default.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval flushes the log on a write once SyncInterval has passed
+	// since the last flush, trading a small window of loss for throughput.
+	SyncInterval
+	// SyncNever leaves flushing to the operating system. Records survive a
+	// process crash but not an operating system crash.
+	SyncNever
+)
+
+// WALOptions configures a durable queue opened with OpenQueue
+type WALOptions[T any] struct {
+	Codec        Codec[T]      // Converts messages to bytes, defaults to JSONCodec
+	Sync         SyncPolicy    // When to flush the log, defaults to SyncAlways
+	SyncInterval time.Duration // The minimum time between flushes for SyncInterval
+	CompactAfter int           // Compact automatically after this many records, 0 to disable
+	OnExpire     ExpiryFunc[T] // The ttl callback attached to restored messages
+	Clock        Clock         // The queue clock, defaults to SystemClock
+}
+
+// The write-ahead log record operations
+const (
+	opPushFront byte = iota + 1
+	opPushBack
+	opRemove
+	opUpdate
+	opResetTTL
+	opMoveFront
+	opMoveBack
+	opMoveBefore
+	opMoveAfter
+	opPushDelayed
+	opRelease
+)
+
+// walRecord is a single operation in the write-ahead log. Expires is the
+// absolute ttl expiry in unix nanoseconds, or zero for no ttl. The move before
+// and after operations carry the mark digest in place of the message. Visible
+// is the unix nanosecond time a delayed message becomes visible, and is only
+// encoded for the push delayed operation.
+type walRecord struct {
+	op      byte
+	digest  string
+	expires int64
+	message []byte
+	visible int64
+}
+
+// writeAheadLog is the append-only log file backing a durable queue
+type writeAheadLog[T any] struct {
+	path     string
+	file     *os.File
+	opts     WALOptions[T]
+	records  int       // Records appended since the last compaction
+	lastSync time.Time // The time of the last flush for SyncInterval
+	err      error     // The first write error, after which logging stops
+}
+
+// OpenQueue opens a durable queue backed by the write-ahead log at path,
+// creating the file if it does not exist. Every push, pull, update, remove and
+// ttl reset is appended to the log, and on open the queue is rebuilt from the
+// log with the same message order, digests and absolute ttl expiry times. A
+// torn record at the end of the log, such as one left by a crash mid-write, is
+// discarded. A corrupt record anywhere else returns an error and the file is
+// left untouched. Leased messages are not logged so they are redelivered after a
+// restart, and delivery attempt counts, dead-letter details and queue settings
+// such as SetMax are not persisted. Restored messages with a ttl get the
+// OnExpire callback since callbacks can not be persisted.
+func OpenQueue[T any](path string, opts WALOptions[T]) (*Queue[T], error) {
+
+	if opts.Codec == nil {
+		opts.Codec = JSONCodec[T]{}
+	}
+	if opts.Clock == nil {
+		opts.Clock = SystemClock{}
+	}
+
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	q := NewQueueWithClock[T](opts.Clock)
+	q.codec = opts.Codec
+
+	valid, records, err := q.replay(file, opts.OnExpire)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	// Discard a torn tail and continue appending from the last good record
+	if err := file.Truncate(valid); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	if _, err := file.Seek(valid, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	q.wal = &writeAheadLog[T]{
+		path:     path,
+		file:     file,
+		opts:     opts,
+		records:  records,
+		lastSync: opts.Clock.Now(),
+	}
+
+	return q, nil
+}
+
+// OpenFlexQueue opens a durable flex queue backed by the write-ahead log at
+// path. See OpenQueue.
+func OpenFlexQueue(path string, opts WALOptions[interface{}]) (*FlexQueue, error) {
+	return OpenQueue[interface{}](path, opts)
+}
+
+// Compact will rewrite the write-ahead log so that it only contains the
+// messages currently in the queue, then atomically replace the old log.
+// Returns ErrNoLog if the queue is not durable.
+func (q *Queue[T]) Compact() error {
+
+	q.Lock()
+	defer q.unlock()
+
+	if q.wal == nil {
+		return ErrNoLog
+	}
+
+	return q.compact()
+}
+
+// SyncLog will flush the write-ahead log to stable storage regardless of the
+// sync policy. Returns ErrNoLog if the queue is not durable.
+func (q *Queue[T]) SyncLog() error {
+
+	q.Lock()
+	defer q.unlock()
+
+	if q.wal == nil {
+		return ErrNoLog
+	}
+
+	if err := q.wal.file.Sync(); err != nil && q.wal.err == nil {
+		q.wal.err = err
+	}
+
+	return q.wal.err
+}
+
+// CloseLog will flush and close the write-ahead log. The queue remains usable
+// but further changes are no longer logged. Returns ErrNoLog if the queue is
+// not durable.
+func (q *Queue[T]) CloseLog() error {
+
+	q.Lock()
+	defer q.unlock()
+
+	if q.wal == nil {
+		return ErrNoLog
+	}
+
+	w := q.wal
+	q.wal = nil
+
+	err := w.file.Sync()
+	if cerr := w.file.Close(); err == nil {
+		err = cerr
+	}
+	if w.err != nil {
+		err = w.err
+	}
+
+	return err
+}
+
+// LogErr returns the first error encountered while writing to the write-ahead
+// log. Once an error occurs further changes are no longer logged, since the
+// log could not be replayed consistently.
+func (q *Queue[T]) LogErr() error {
+
+	q.RLock()
+	defer q.RUnlock()
+
+	if q.wal == nil {
+		return nil
+	}
+
+	return q.wal.err
+}
+
+// logPush will append a push record, including the absolute ttl expiry
+func (q *Queue[T]) logPush(front bool, digest string, message T, ctrl *TTLControl[T]) {
+
+	if q.wal == nil {
+		return
+	}
+
+	data, err := q.codec.Encode(message)
+	if err != nil {
+		q.wal.fail(err)
+		return
+	}
+
+	rec := walRecord{
+		op:      opPushBack,
+		digest:  digest,
+		message: data,
+	}
+	if front {
+		rec.op = opPushFront
+	}
+	if ctrl != nil {
+		rec.expires = ctrl.Expires.UnixNano()
+	}
+
+	q.logRecord(rec)
+}
+
+// logRemove will append a remove record, which covers every way a message
+// can leave the queue
+func (q *Queue[T]) logRemove(digest string) {
+
+	if q.wal == nil {
+		return
+	}
+
+	q.logRecord(walRecord{
+		op:     opRemove,
+		digest: digest,
+	})
+}
+
+// logUpdate will append an update record
+func (q *Queue[T]) logUpdate(digest string, message T) {
+
+	if q.wal == nil {
+		return
+	}
+
+	data, err := q.codec.Encode(message)
+	if err != nil {
+		q.wal.fail(err)
+		return
+	}
+
+	q.logRecord(walRecord{
+		op:      opUpdate,
+		digest:  digest,
+		message: data,
+	})
+}
+
+// logResetTTL will append a ttl reset record
+func (q *Queue[T]) logResetTTL(digest string, expires time.Time) {
+
+	if q.wal == nil {
+		return
+	}
+
+	q.logRecord(walRecord{
+		op:      opResetTTL,
+		digest:  digest,
+		expires: expires.UnixNano(),
+	})
+}
+
+// logPushDelayed will append a record which stores a delayed message
+func (q *Queue[T]) logPushDelayed(digest string, message T, at time.Time, ctrl *TTLControl[T]) {
+
+	if q.wal == nil {
+		return
+	}
+
+	data, err := q.codec.Encode(message)
+	if err != nil {
+		q.wal.fail(err)
+		return
+	}
+
+	rec := walRecord{
+		op:      opPushDelayed,
+		digest:  digest,
+		message: data,
+		visible: at.UnixNano(),
+	}
+	if ctrl != nil {
+		rec.expires = ctrl.Expires.UnixNano()
+	}
+
+	q.logRecord(rec)
+}
+
+// logRelease will append a record which moves a delayed message to the back
+// of the queue once it is visible
+func (q *Queue[T]) logRelease(digest string) {
+
+	if q.wal == nil {
+		return
+	}
+
+	q.logRecord(walRecord{
+		op:     opRelease,
+		digest: digest,
+	})
+}
+
+// logMove will append a record which moves a message within the queue. The
+// mark is the digest the message was moved next to, if any.
+func (q *Queue[T]) logMove(op byte, digest string, mark string) {
+
+	if q.wal == nil {
+		return
+	}
+
+	rec := walRecord{
+		op:     op,
+		digest: digest,
+	}
+	if op == opMoveBefore || op == opMoveAfter {
+		rec.message = []byte(mark)
+	}
+
+	q.logRecord(rec)
+}
+
+// logRecord will append the record. The log is compacted by unlock once the
+// change which logged the record is complete.
+func (q *Queue[T]) logRecord(rec walRecord) {
+
+	w := q.wal
+	if w.err != nil {
+		return
+	}
+
+	if _, err := w.file.Write(rec.frame()); err != nil {
+		w.fail(err)
+		return
+	}
+	w.records++
+
+	switch w.opts.Sync {
+	case SyncAlways:
+		w.sync()
+	case SyncInterval:
+		if now := q.clock.Now(); now.Sub(w.lastSync) >= w.opts.SyncInterval {
+			w.sync()
+			w.lastSync = now
+		}
+	}
+}
+
+// compactIfDue will compact the log if it has grown past the CompactAfter
+// option. It must only be called once a change has been fully applied, since
+// compaction writes out the current queue state in place of the log.
+func (q *Queue[T]) compactIfDue() {
+
+	w := q.wal
+	if w != nil && w.opts.CompactAfter > 0 && w.records >= w.opts.CompactAfter {
+		_ = q.compact()
+	}
+}
+
+// compact is the unlocked implementation of Compact
+func (q *Queue[T]) compact() error {
+
+	w := q.wal
+	if w.err != nil {
+		return w.err
+	}
+
+	tmp := w.path + ".compact"
+	file, err := os.OpenFile(tmp, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+
+	records, err := q.writeState(file, false)
+	if err == nil {
+		err = file.Sync()
+	}
+	if err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+
+	if err := os.Rename(tmp, w.path); err != nil {
+		_ = file.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(w.path))
+
+	// The renamed file is positioned at its end and becomes the live log
+	_ = w.file.Close()
+	w.file = file
+	w.records = records
+
+	return nil
+}
+
+// writeState will write a push record for every message in the queue, in
+// order, so that replaying them rebuilds the current state. Leased messages
+// are written first in the order their leases run out so they are redelivered
+// first, and delayed messages are written last in the order they become
+// visible, along with that time. Ties are ordered by digest so the output is
+// deterministic. Messages with an expired
+// ttl are left out if skipExpired is true.
+func (q *Queue[T]) writeState(wr io.Writer, skipExpired bool) (int, error) {
+
+	bw := bufio.NewWriter(wr)
+	records := 0
+	now := q.clock.Now()
+
+	write := func(digest string, message T, visible time.Time) error {
+		rec := walRecord{
+			op:     opPushBack,
+			digest: digest,
+		}
+		if !visible.IsZero() {
+			rec.op = opPushDelayed
+			rec.visible = visible.UnixNano()
+		}
+		if ctrl, ok := q.ttl.get(digest); ok {
+			if skipExpired && ctrl.ExpiredAt(now) {
+				return nil
+			}
+			rec.expires = ctrl.Expires.UnixNano()
+		}
+		data, err := q.codec.Encode(message)
+		if err != nil {
+			return err
+		}
+		rec.message = data
+		records++
+		_, err = bw.Write(rec.frame())
+		return err
+	}
+
+	// Leases are keyed by a random receipt so ties are ordered by digest
+	leases := q.leases.sorted(func(entry *expiryEntry[*lease[T]]) string {
+		return entry.value.digest
+	})
+	for _, entry := range leases {
+		if err := write(entry.value.digest, entry.value.message, time.Time{}); err != nil {
+			return records, err
+		}
+	}
+
+	for e := q.messages.items.Front(); e != nil; e = e.Next() {
+		wrapper := e.Value.(*itemWrapper[string, T])
+		if err := write(wrapper.index, wrapper.item, time.Time{}); err != nil {
+			return records, err
+		}
+	}
+
+	for _, entry := range q.delayed.sorted(nil) {
+		if err := write(entry.key, entry.value, entry.expires); err != nil {
+			return records, err
+		}
+	}
+
+	return records, bw.Flush()
+}
+
+// replay will rebuild the queue state from the log. A torn or corrupt record
+// at the end of the log is discarded, but a corrupt record anywhere else is an
+// error. Returns the offset of the end of the last good record and the number
+// of records read.
+func (q *Queue[T]) replay(r io.Reader, onExpire ExpiryFunc[T]) (int64, int, error) {
+
+	br := bufio.NewReader(r)
+
+	var (
+		valid   int64
+		records int
+	)
+
+	for {
+		rec, n, err := readRecord(br)
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return valid, records, nil
+		}
+		if err == errCorruptRecord {
+			// Only the last record can be torn by a crash mid-write. A corrupt
+			// record followed by more data means the log itself is damaged,
+			// and truncating it would silently drop every record after it.
+			if _, err := br.Peek(1); err == io.EOF {
+				return valid, records, nil
+			}
+			return valid, records, fmt.Errorf("%w at offset %d", errCorruptRecord, valid)
+		}
+		if err != nil {
+			return valid, records, err
+		}
+		if err := q.apply(rec, onExpire); err != nil {
+			return valid, records, err
+		}
+		valid += n
+		records++
+	}
+}
+
+// apply will perform a single log record against the queue state without
+// logging it again. Restored ttl controls get the onExpire callback.
+func (q *Queue[T]) apply(rec walRecord, onExpire ExpiryFunc[T]) error {
+
+	switch rec.op {
+	case opPushFront, opPushBack:
+		message, err := q.codec.Decode(rec.message)
+		if err != nil {
+			return err
+		}
+		if rec.op == opPushFront {
+			_ = q.messages.PushFront(rec.digest, message)
+		} else {
+			_ = q.messages.PushBack(rec.digest, message)
+		}
+		if rec.expires != 0 {
+			expires := time.Unix(0, rec.expires)
+			q.ttl.set(rec.digest, TTLControl[T]{
+				Expires:  expires,
+				Callback: onExpire,
+			}, expires)
+		}
+	case opRemove:
+		_ = q.messages.Remove(rec.digest)
+		_ = q.ttl.delete(rec.digest)
+		_ = q.delayed.delete(rec.digest)
+	case opUpdate:
+		message, err := q.codec.Decode(rec.message)
+		if err != nil {
+			return err
+		}
+		_ = q.messages.Update(rec.digest, message)
+	case opResetTTL:
+		ctrl, ok := q.ttl.get(rec.digest)
+		if !ok {
+			ctrl.Callback = onExpire
+		}
+		ctrl.Expires = time.Unix(0, rec.expires)
+		q.ttl.set(rec.digest, ctrl, ctrl.Expires)
+	case opPushDelayed:
+		message, err := q.codec.Decode(rec.message)
+		if err != nil {
+			return err
+		}
+		q.delayed.set(rec.digest, message, time.Unix(0, rec.visible))
+		if rec.expires != 0 {
+			expires := time.Unix(0, rec.expires)
+			q.ttl.set(rec.digest, TTLControl[T]{
+				Expires:  expires,
+				Callback: onExpire,
+			}, expires)
+		}
+	case opRelease:
+		if message, ok := q.delayed.get(rec.digest); ok {
+			_ = q.delayed.delete(rec.digest)
+			_ = q.messages.PushBack(rec.digest, message)
+		}
+	case opMoveFront:
+		_ = q.messages.MoveToFront(rec.digest)
+	case opMoveBack:
+		_ = q.messages.MoveToBack(rec.digest)
+	case opMoveBefore:
+		_ = q.messages.MoveBefore(rec.digest, string(rec.message))
+	case opMoveAfter:
+		_ = q.messages.MoveAfter(rec.digest, string(rec.message))
+	default:
+		return errCorruptRecord
+	}
+
+	return nil
+}
+
+// fail will record the first write error
+func (w *writeAheadLog[T]) fail(err error) {
+	if w.err == nil {
+		w.err = err
+	}
+}
+
+// sync will flush the log file to stable storage
+func (w *writeAheadLog[T]) sync() {
+	if err := w.file.Sync(); err != nil {
+		w.fail(err)
+	}
+}
+
+// frame encodes the record with a length and checksum header so that torn
+// or corrupt records can be detected on replay
+func (r walRecord) frame() []byte {
+
+	payload := []byte{r.op}
+	payload = appendUvarint(payload, uint64(len(r.digest)))
+	payload = append(payload, r.digest...)
+	payload = appendVarint(payload, r.expires)
+	payload = appendUvarint(payload, uint64(len(r.message)))
+	payload = append(payload, r.message...)
+	if r.op == opPushDelayed {
+		payload = appendVarint(payload, r.visible)
+	}
+
+	buf := make([]byte, 8, 8+len(payload))
+	binary.LittleEndian.PutUint32(buf[0:4], uint32(len(payload)))
+	binary.LittleEndian.PutUint32(buf[4:8], crc32.ChecksumIEEE(payload))
+
+	return append(buf, payload...)
+}
+
+// maxRecordPrealloc is the most memory allocated for a record payload before
+// its bytes have been read
+const maxRecordPrealloc = 1 << 16
+
+// readRecord reads and decodes the next framed record. Returns the record and
+// the number of bytes it occupied.
+func readRecord(br *bufio.Reader) (walRecord, int64, error) {
+
+	var rec walRecord
+
+	header := make([]byte, 8)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return rec, 0, err
+	}
+
+	size := binary.LittleEndian.Uint32(header[0:4])
+	sum := binary.LittleEndian.Uint32(header[4:8])
+
+	// The size comes from a header which may itself be torn or corrupt, so
+	// the payload is only allocated as the bytes actually arrive
+	prealloc := size
+	if prealloc > maxRecordPrealloc {
+		prealloc = maxRecordPrealloc
+	}
+	buf := bytes.NewBuffer(make([]byte, 0, prealloc))
+	if _, err := io.CopyN(buf, br, int64(size)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return rec, 0, err
+	}
+	payload := buf.Bytes()
+	if crc32.ChecksumIEEE(payload) != sum || size == 0 {
+		return rec, 0, errCorruptRecord
+	}
+
+	rec.op = payload[0]
+	rest := payload[1:]
+
+	digest, rest, ok := readBytes(rest)
+	if !ok {
+		return rec, 0, errCorruptRecord
+	}
+	expires, n := binary.Varint(rest)
+	if n <= 0 {
+		return rec, 0, errCorruptRecord
+	}
+	message, rest, ok := readBytes(rest[n:])
+	if !ok {
+		return rec, 0, errCorruptRecord
+	}
+	if rec.op == opPushDelayed {
+		visible, n := binary.Varint(rest)
+		if n <= 0 {
+			return rec, 0, errCorruptRecord
+		}
+		rec.visible = visible
+	}
+
+	rec.digest = string(digest)
+	rec.expires = expires
+	rec.message = message
+
+	return rec, int64(8 + size), nil
+}
+
+// readBytes reads a length prefixed byte slice
+func readBytes(b []byte) ([]byte, []byte, bool) {
+
+	size, n := binary.Uvarint(b)
+	if n <= 0 || uint64(len(b)-n) < size {
+		return nil, nil, false
+	}
+
+	return b[n : n+int(size)], b[n+int(size):], true
+}
+
+// appendUvarint appends the uvarint encoding of x to b
+func appendUvarint(b []byte, x uint64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutUvarint(buf[:], x)]...)
+}
+
+// appendVarint appends the varint encoding of x to b
+func appendVarint(b []byte, x int64) []byte {
+	var buf [binary.MaxVarintLen64]byte
+	return append(b, buf[:binary.PutVarint(buf[:], x)]...)
+}
+
+// syncDir flushes a directory so that a rename within it is durable. Errors
+// are ignored since not every platform supports syncing a directory.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		_ = d.Sync()
+		_ = d.Close()
+	}
+}
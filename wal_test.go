@@ -0,0 +1,320 @@
+package flexqueue_test
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/gregtzar/flexqueue"
+)
+
+// drain pulls every message from the queue and returns their digests in order
+func drain(queue *flexqueue.Queue[Message]) []string {
+	digests := []string{}
+	for {
+		digest, _, ok := queue.PullFront()
+		if !ok {
+			return digests
+		}
+		digests = append(digests, digest)
+	}
+}
+
+func TestWALRecovery(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queue.wal")
+	clock := flexqueue.NewFakeClock(time.Now())
+
+	queue, err := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{Clock: clock})
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+
+	cbFunc := func(digest string, message Message) {}
+
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBackTTL("B", Message{Digest: "B"}, time.Hour, cbFunc)
+	queue.PushFront("C", Message{Digest: "C"})
+	queue.PushBack("D", Message{Digest: "D"})
+	queue.PushBack("E", Message{Digest: "E"})
+	queue.Update("A", Message{Digest: "A", TTL: time.Second})
+	queue.ResetTTL("B", time.Minute)
+	queue.PullFront()
+	queue.Remove("D")
+
+	if err := queue.CloseLog(); err != nil {
+		t.Fatalf("expected close error to be nil but got %v instead", err)
+	}
+
+	expired := []string{}
+	restored, err := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{
+		Clock: clock,
+		OnExpire: func(digest string, message Message) {
+			expired = append(expired, digest)
+		},
+	})
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+	defer restored.CloseLog()
+
+	if restored.Len() != 3 {
+		t.Errorf("expected restored len to be %v but got %v instead", 3, restored.Len())
+	}
+	if message, _ := restored.Read("A"); message.TTL != time.Second {
+		t.Errorf("expected restored update to be %v but got %v instead", time.Second, message.TTL)
+	}
+
+	// the absolute expiry of the reset ttl is restored
+	clock.Advance(time.Minute + time.Nanosecond)
+
+	if digests := drain(restored); fmt.Sprint(digests) != fmt.Sprint([]string{"A", "E"}) {
+		t.Errorf("expected restored order to be %v but got %v instead", []string{"A", "E"}, digests)
+	}
+	if fmt.Sprint(expired) != fmt.Sprint([]string{"B"}) {
+		t.Errorf("expected restored expiry to fire for %v but got %v instead", []string{"B"}, expired)
+	}
+}
+
+func TestWALTornTail(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	queue, _ := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{Sync: flexqueue.SyncNever})
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("B", Message{Digest: "B"})
+	queue.CloseLog()
+
+	// cut the last record in half as if the process crashed mid-write
+	info, _ := os.Stat(path)
+	if err := os.Truncate(path, info.Size()-3); err != nil {
+		t.Fatalf("expected truncate error to be nil but got %v instead", err)
+	}
+
+	restored, err := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+
+	// appends continue after the last good record
+	restored.PushBack("C", Message{Digest: "C"})
+	restored.CloseLog()
+
+	restored, _ = flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	defer restored.CloseLog()
+
+	if digests := drain(restored); fmt.Sprint(digests) != fmt.Sprint([]string{"A", "C"}) {
+		t.Errorf("expected restored order to be %v but got %v instead", []string{"A", "C"}, digests)
+	}
+}
+
+func TestWALCorruptRecord(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	// note where the second record ends
+	queue, _ := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("B", Message{Digest: "B"})
+	second, _ := os.Stat(path)
+	queue.PushBack("C", Message{Digest: "C"})
+	queue.CloseLog()
+
+	flip := func(offset int64) {
+		data, _ := os.ReadFile(path)
+		data[offset] ^= 0xff
+		if err := os.WriteFile(path, data, 0o644); err != nil {
+			t.Fatalf("expected write error to be nil but got %v instead", err)
+		}
+	}
+
+	// a corrupt record in the middle of the log is an error and the log is
+	// left untouched
+	flip(second.Size() - 1)
+	before, _ := os.Stat(path)
+
+	if _, err := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{}); err == nil {
+		t.Errorf("expected open of a corrupt log to return an error")
+	}
+	if after, _ := os.Stat(path); after.Size() != before.Size() {
+		t.Errorf("expected log size to be %v but got %v instead", before.Size(), after.Size())
+	}
+
+	// once the corrupt record is the last one it is treated as a torn tail
+	flip(second.Size() - 1)
+	flip(before.Size() - 1)
+
+	restored, err := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+	defer restored.CloseLog()
+
+	if digests := drain(restored); fmt.Sprint(digests) != fmt.Sprint([]string{"A", "B"}) {
+		t.Errorf("expected restored order to be %v but got %v instead", []string{"A", "B"}, digests)
+	}
+}
+
+func TestWALTornHeader(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	queue, _ := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.CloseLog()
+
+	// a garbage header claims a record of almost 4 GiB
+	file, _ := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o644)
+	_, _ = file.Write([]byte{0xf0, 0xff, 0xff, 0xff, 0, 0, 0, 0, 1, 2, 3})
+	file.Close()
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+
+	restored, err := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	if err != nil {
+		t.Fatalf("expected open error to be nil but got %v instead", err)
+	}
+	defer restored.CloseLog()
+
+	runtime.ReadMemStats(&after)
+
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("expected the torn header not to be allocated but got %v bytes", allocated)
+	}
+	if digests := drain(restored); fmt.Sprint(digests) != fmt.Sprint([]string{"A"}) {
+		t.Errorf("expected restored order to be %v but got %v instead", []string{"A"}, digests)
+	}
+}
+
+func TestWALCompaction(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	queue, _ := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{
+		Sync:         flexqueue.SyncInterval,
+		SyncInterval: time.Second,
+		CompactAfter: 50,
+	})
+
+	for i := 0; i < 100; i++ {
+		digest := fmt.Sprint(i)
+		queue.PushBack(digest, Message{Digest: digest})
+		if i%10 != 0 {
+			queue.Remove(digest)
+		}
+	}
+
+	if err := queue.Compact(); err != nil {
+		t.Fatalf("expected compact error to be nil but got %v instead", err)
+	}
+
+	// the compacted log holds one record per live message
+	compacted, _ := os.Stat(path)
+
+	queue.PushBack("X", Message{Digest: "X"})
+	if err := queue.SyncLog(); err != nil {
+		t.Errorf("expected sync error to be nil but got %v instead", err)
+	}
+	queue.CloseLog()
+
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Errorf("expected temporary compaction file to be removed")
+	}
+
+	restored, _ := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	defer restored.CloseLog()
+
+	want := []string{"0", "10", "20", "30", "40", "50", "60", "70", "80", "90", "X"}
+	if digests := drain(restored); fmt.Sprint(digests) != fmt.Sprint(want) {
+		t.Errorf("expected restored order to be %v but got %v instead", want, digests)
+	}
+
+	// 100 pushes and 90 removes would be far larger than 10 records
+	if compacted.Size() > 10*64 {
+		t.Errorf("expected compacted log to be small but got %v bytes", compacted.Size())
+	}
+}
+
+func TestWALCompactionDelayed(t *testing.T) {
+
+	clock := flexqueue.NewFakeClock(time.Now())
+	cbFunc := func(digest string, message Message) {}
+
+	tests := []struct {
+		name  string
+		leave func(queue *flexqueue.Queue[Message])
+	}{
+		{"remove", func(queue *flexqueue.Queue[Message]) {
+			queue.Remove("D")
+		}},
+		{"expire", func(queue *flexqueue.Queue[Message]) {
+			clock.Advance(time.Second * 2)
+			queue.Prune()
+		}},
+	}
+
+	for _, test := range tests {
+
+		path := filepath.Join(t.TempDir(), "queue.wal")
+		opts := flexqueue.WALOptions[Message]{Clock: clock, CompactAfter: 2}
+
+		// the remove record triggers a compaction, which must not write the
+		// delayed message back into the new log
+		queue, _ := flexqueue.OpenQueue(path, opts)
+		queue.PushBackDelayedTTL("D", Message{Digest: "D"}, time.Hour, time.Second, cbFunc)
+		test.leave(queue)
+		queue.CloseLog()
+
+		restored, _ := flexqueue.OpenQueue(path, opts)
+		if delayed := restored.Delayed(); delayed != 0 || restored.Has("D") {
+			t.Errorf("%v: expected %v to not be restored but got %v delayed", test.name, "D", delayed)
+		}
+		restored.CloseLog()
+	}
+}
+
+func TestWALLeaseRedelivery(t *testing.T) {
+
+	path := filepath.Join(t.TempDir(), "queue.wal")
+
+	queue, _ := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	queue.PushBack("A", Message{Digest: "A"})
+	queue.PushBack("B", Message{Digest: "B"})
+	queue.PushBack("C", Message{Digest: "C"})
+
+	// an acked message is gone, a nacked one moves to the front and an
+	// outstanding lease is redelivered after a restart
+	receipt, _, _, _ := queue.LeaseFront(time.Minute)
+	queue.Ack(receipt)
+	queue.LeaseFront(time.Minute)
+	receipt, _, _, _ = queue.LeaseBack(time.Minute)
+	queue.Nack(receipt)
+	queue.CloseLog()
+
+	restored, _ := flexqueue.OpenQueue(path, flexqueue.WALOptions[Message]{})
+	defer restored.CloseLog()
+
+	if digests := drain(restored); fmt.Sprint(digests) != fmt.Sprint([]string{"C", "B"}) {
+		t.Errorf("expected restored order to be %v but got %v instead", []string{"C", "B"}, digests)
+	}
+}
+
+func TestWALNotDurable(t *testing.T) {
+
+	queue := flexqueue.NewFlexQueue()
+
+	if err := queue.Compact(); !errors.Is(err, flexqueue.ErrNoLog) {
+		t.Errorf("expected compact error to be %v but got %v instead", flexqueue.ErrNoLog, err)
+	}
+	if err := queue.CloseLog(); !errors.Is(err, flexqueue.ErrNoLog) {
+		t.Errorf("expected close error to be %v but got %v instead", flexqueue.ErrNoLog, err)
+	}
+	if err := queue.LogErr(); err != nil {
+		t.Errorf("expected log error to be nil but got %v instead", err)
+	}
+}